@@ -0,0 +1,208 @@
+package gqlserver
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxtroughear/gqlserver/cache"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAdminAPQLimit = 100
+
+	// timeouts of the admin server, which are fixed as CPU profiles and
+	// traces are written for as long as they are requested
+	adminReadHeaderTimeout = 10 * time.Second
+	adminIdleTimeout       = 2 * time.Minute
+)
+
+// adminAuth rejects requests without the admin token, when a token is set
+func adminAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+
+	return func(ginContext *gin.Context) {
+		ginContext.Header("Cache-Control", "no-store")
+
+		if token == "" {
+			return
+		}
+
+		auth := []byte(ginContext.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(auth, expected) != 1 {
+			ginContext.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+}
+
+// newAdminServer creates the admin server, serving pprof, metrics, health
+// and readiness details, the effective config, the persisted query cache
+// and the log level
+func (s *Server) newAdminServer() (*http.Server, error) {
+	cfg := s.config.Admin
+
+	tlsConfig, err := newAdminTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery(), adminAuth(cfg.Token))
+
+	router.GET("/debug/pprof/*profile", pprofHandler)
+	router.POST("/debug/pprof/*profile", pprofHandler)
+
+	if s.metrics != nil {
+		router.GET("/metrics", gin.WrapH(s.metricsHandler()))
+	}
+
+	router.GET("/health", s.health.DetailHandler())
+	router.GET("/ready", s.readiness.DetailHandler())
+	router.GET("/config", s.configHandler())
+	router.GET("/apq", s.apqHandler())
+	router.GET("/log-level", s.logLevelHandler())
+	router.PUT("/log-level", s.setLogLevelHandler())
+
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+		Handler:           router,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: adminReadHeaderTimeout,
+		IdleTimeout:       adminIdleTimeout,
+	}, nil
+}
+
+func newAdminTLSConfig(cfg AdminConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("admin: %w", err)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// loopbackAddress reports whether address only accepts local connections
+func loopbackAddress(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
+
+func pprofHandler(ginContext *gin.Context) {
+	switch ginContext.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(ginContext.Writer, ginContext.Request)
+	case "/profile":
+		pprof.Profile(ginContext.Writer, ginContext.Request)
+	case "/symbol":
+		pprof.Symbol(ginContext.Writer, ginContext.Request)
+	case "/trace":
+		pprof.Trace(ginContext.Writer, ginContext.Request)
+	default:
+		pprof.Index(ginContext.Writer, ginContext.Request)
+	}
+}
+
+// apqHandler lists the persisted queries in the APQ cache, up to the limit
+// query parameter
+func (s *Server) apqHandler() gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		lister, ok := s.config.ApqCache.(cache.Lister)
+		if !ok {
+			ginContext.JSON(http.StatusNotImplemented, gin.H{
+				"error": "persisted query cache can't be listed",
+			})
+			return
+		}
+
+		limit := defaultAdminAPQLimit
+		if value := ginContext.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				ginContext.JSON(http.StatusBadRequest, gin.H{
+					"error": "limit must be a positive integer",
+				})
+				return
+			}
+			limit = parsed
+		}
+
+		entries, err := lister.Entries(ginContext.Request.Context(), limit)
+		if err != nil {
+			s.Logger.WithError(err).Error("failed to list persisted queries")
+			ginContext.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list persisted queries",
+			})
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+		})
+	}
+}
+
+func (s *Server) logLevelHandler() gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		ginContext.JSON(http.StatusOK, gin.H{
+			"level": s.Logger.Logger.GetLevel().String(),
+		})
+	}
+}
+
+// setLogLevelHandler changes the log level until the config is next reloaded
+func (s *Server) setLogLevelHandler() gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := ginContext.ShouldBindJSON(&body); err != nil {
+			ginContext.JSON(http.StatusBadRequest, gin.H{
+				"error": "expected a JSON body with a level",
+			})
+			return
+		}
+
+		level, err := logrus.ParseLevel(body.Level)
+		if err != nil {
+			ginContext.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		s.reloader.setLogLevel(s.Logger.Logger, level)
+		s.Logger.WithField("level", level.String()).Info("log level changed")
+
+		ginContext.JSON(http.StatusOK, gin.H{
+			"level": level.String(),
+		})
+	}
+}
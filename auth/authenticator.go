@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4/request"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/sirupsen/logrus"
+)
+
+type principalContextKey struct{}
+
+// Authenticator verifies tokens issued by an identity provider
+type Authenticator interface {
+	// Authenticate verifies a raw token and returns a context containing the
+	// authenticated Principal along with any provider specific token
+	Authenticate(ctx context.Context, rawToken string) (context.Context, *Principal, error)
+
+	// Middleware retrieves and verifies a token via a header or cookie and
+	// passes the authenticated Principal into the current context
+	Middleware() gin.HandlerFunc
+}
+
+// Principal is the provider-neutral identity of an authenticated user
+type Principal struct {
+	// Name of the provider which verified the token, e.g. "firebase" or "jwks"
+	Provider string
+
+	// Subject of the token, the user's unique ID with the provider
+	Subject string
+
+	Issuer    string
+	Audience  []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	AuthTime  time.Time
+
+	// All claims of the verified token, including custom claims
+	Claims map[string]interface{}
+}
+
+// PrincipalFromContext retrieves the authenticated Principal from the current
+// context, regardless of which provider verified it
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	if !ok {
+		return nil
+	}
+	return principal
+}
+
+// UIDKey identifies requests by the authenticated user's ID, for limiting
+// requests with middleware.RateLimit. Unauthenticated requests have no key
+func UIDKey(c *gin.Context) string {
+	principal := PrincipalFromContext(c.Request.Context())
+	if principal == nil {
+		return ""
+	}
+	return "uid:" + principal.Provider + ":" + principal.Subject
+}
+
+// WithPrincipal returns a copy of ctx holding principal, as authenticated
+// requests do. Useful for testing resolvers and directives
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// defaultExtractor finds tokens in the Authorization header or the "token" cookie
+func defaultExtractor() request.Extractor {
+	return request.MultiExtractor{
+		request.AuthorizationHeaderExtractor,
+		cookieTokenExtractor{},
+	}
+}
+
+// authMiddleware authenticates requests using the token found by extractor.
+// Requests always continue through the middleware pipeline, whether or not
+// they could be authenticated.
+func authMiddleware(a Authenticator, provider string, extractor request.Extractor, segmentName string) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		ctx := ginContext.Request.Context()
+		log := middleware.LogrusFromContext(ctx)
+
+		tx := newrelic.FromContext(ctx)
+		var segment *newrelic.Segment
+		if tx != nil {
+			segment = tx.StartSegment(segmentName)
+		}
+
+		rawToken, err := extractor.ExtractToken(ginContext.Request)
+		if err == request.ErrNoTokenInRequest {
+			log.Debugf("%s auth token missing", provider)
+		} else if err != nil {
+			log.WithError(err).Error("error while attempting to authenticate user. request continuing")
+		} else if authCtx, principal, err := a.Authenticate(ctx, rawToken); err != nil {
+			log.WithError(err).Error("error while attempting to authenticate user. request continuing")
+		} else {
+			log.WithFields(logrus.Fields{
+				provider + ".uid":      principal.Subject,
+				provider + ".issueAt":  principal.IssuedAt,
+				provider + ".expires":  principal.ExpiresAt,
+				provider + ".authTime": principal.AuthTime,
+			}).Debugf("%s auth token verified", provider)
+
+			if segment != nil {
+				segment.AddAttribute(provider+".uid", principal.Subject)
+				segment.AddAttribute(provider+".issueAt", principal.IssuedAt.Unix())
+				segment.AddAttribute(provider+".expires", principal.ExpiresAt.Unix())
+				segment.AddAttribute(provider+".authTime", principal.AuthTime.Unix())
+			}
+
+			middleware.RequestInfoFromContext(ctx).SetUserID(principal.Subject)
+
+			ctx = authCtx
+		}
+
+		ginContext.Request = ginContext.Request.WithContext(ctx)
+
+		if segment != nil {
+			segment.End()
+		}
+
+		ginContext.Next()
+	}
+}
+
+type cookieTokenExtractor struct{}
+
+func (c cookieTokenExtractor) ExtractToken(r *http.Request) (string, error) {
+	cookie, err := r.Cookie("token")
+	if err != nil {
+		return "", request.ErrNoTokenInRequest
+	}
+	return cookie.Value, nil
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type AuthConfig struct {
 	// Enable Firebase auth
 	FirebaseEnabled bool `env:"AUTH_FIREBASE_ENABLED"`
@@ -8,5 +10,31 @@ type AuthConfig struct {
 	FirebaseCredentialsFile string `env:"AUTH_FIREBASE_CREDENTIALS_FILE"`
 
 	// Firebase credentials JSON
-	FirebaseCredentialsJSON string `env:"AUTH_FIREBASE_CREDENTIALS_JSON"`
+	FirebaseCredentialsJSON string `env:"AUTH_FIREBASE_CREDENTIALS_JSON" secret:"true"`
+
+	// Enable JWT auth using keys from a JSON Web Key Set.
+	// Firebase auth takes precedence when both are enabled
+	JWKSEnabled bool `env:"AUTH_JWKS_ENABLED"`
+
+	// Expected issuer (iss) of tokens. Also used to discover the JWKS URL
+	// when neither a URL or key file is set
+	JWKSIssuer string `env:"AUTH_JWKS_ISSUER"`
+
+	// Expected audience (aud) of tokens
+	JWKSAudience string `env:"AUTH_JWKS_AUDIENCE"`
+
+	// URL of the JSON Web Key Set
+	JWKSURL string `env:"AUTH_JWKS_URL"`
+
+	// Path to a local JSON Web Key Set or PEM encoded public key
+	JWKSKeyFile string `env:"AUTH_JWKS_KEY_FILE"`
+
+	// Signing algorithms accepted, defaults to DefaultJWKSAlgorithms
+	JWKSAllowedAlgorithms []string `env:"AUTH_JWKS_ALLOWED_ALGORITHMS"`
+
+	// Clock skew tolerated when validating exp, nbf and iat
+	JWKSClockSkew time.Duration `env:"AUTH_JWKS_CLOCK_SKEW"`
+
+	// How often the JSON Web Key Set is refreshed to pick up rotated keys
+	JWKSRefreshInterval time.Duration `env:"AUTH_JWKS_REFRESH_INTERVAL"`
 }
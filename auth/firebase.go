@@ -3,15 +3,12 @@ package auth
 import (
 	"context"
 	"log"
-	"net/http"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4/request"
-	"github.com/maxtroughear/gqlserver/middleware"
-	"github.com/newrelic/go-agent/v3/newrelic"
-	"github.com/sirupsen/logrus"
 	"google.golang.org/api/option"
 )
 
@@ -44,86 +41,56 @@ func NewFirebaseAuth(cfg AuthConfig) FirebaseAuth {
 	}
 
 	return FirebaseAuth{
-		app:        app,
-		authClient: authClient,
-		jwtExtractor: request.MultiExtractor{
-			request.AuthorizationHeaderExtractor,
-			cookieTokenExtractor{},
-		},
+		app:          app,
+		authClient:   authClient,
+		jwtExtractor: defaultExtractor(),
 	}
 }
 
+var _ Authenticator = &FirebaseAuth{}
+
 // FirebaseAuthMiddleware retrieves and verifies a Firebase auth token via
 // a header or cookie and passes the token into the current context.
 // It also adds the FirebaseAuth instance to the current context
 func (a *FirebaseAuth) FirebaseAuthMiddleware() gin.HandlerFunc {
-	return func(ginContext *gin.Context) {
-		ctx := ginContext.Request.Context()
-		log := middleware.LogrusFromContext(ctx)
-
-		tx := newrelic.FromContext(ctx)
-		var segment *newrelic.Segment
-		if tx != nil {
-			segment = tx.StartSegment("Gin/Middleware/FirebaseAuth")
-		}
-
-		// always continue through middleware pipeline
-		defer func(ginContext *gin.Context, segment *newrelic.Segment) {
-			if segment != nil {
-				segment.End()
-			}
-
-		}(ginContext, segment)
-
-		ctx = context.WithValue(ctx, firebaseAuthContextKey{}, a)
-
-		token, err := authenticateUser(ctx, ginContext, a)
-		if err != nil {
-			log.WithError(err).Error("error while attempting to authenticate user. request continuing")
-		} else if token != nil {
-			log.WithFields(logrus.Fields{
-				"firebase.uid":      token.UID,
-				"firebase.issueAt":  token.IssuedAt,
-				"firebase.expires":  token.Expires,
-				"firebase.authTime": token.AuthTime,
-			}).Debugf("firebase auth token verified")
-
-			if segment != nil {
-				segment.AddAttribute("firebase.uid", token.UID)
-				segment.AddAttribute("firebase.issueAt", token.IssuedAt)
-				segment.AddAttribute("firebase.expires", token.Expires)
-				segment.AddAttribute("firebase.authTime", token.AuthTime)
-			}
-
-			ctx = context.WithValue(ctx, firebaseAuthTokenContextKey{}, token)
-		} else {
-			log.Debugf("firebase auth token missing")
-		}
+	authenticate := authMiddleware(a, "firebase", a.jwtExtractor, "Gin/Middleware/FirebaseAuth")
 
+	return func(ginContext *gin.Context) {
+		ctx := context.WithValue(ginContext.Request.Context(), firebaseAuthContextKey{}, a)
 		ginContext.Request = ginContext.Request.WithContext(ctx)
 
-		if segment != nil {
-			segment.End()
-		}
-
-		ginContext.Next()
+		authenticate(ginContext)
 	}
 }
 
-func authenticateUser(ctx context.Context, ginContext *gin.Context, a *FirebaseAuth) (*auth.Token, error) {
-	idToken, err := a.jwtExtractor.ExtractToken(ginContext.Request)
-	if err == request.ErrNoTokenInRequest {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
-	}
+// Middleware implements Authenticator using FirebaseAuthMiddleware
+func (a *FirebaseAuth) Middleware() gin.HandlerFunc {
+	return a.FirebaseAuthMiddleware()
+}
 
-	token, err := a.authClient.VerifyIDToken(ctx, idToken)
+// Authenticate verifies a Firebase ID token and passes both the token and the
+// resulting Principal into the returned context
+func (a *FirebaseAuth) Authenticate(ctx context.Context, rawToken string) (context.Context, *Principal, error) {
+	token, err := a.authClient.VerifyIDToken(ctx, rawToken)
 	if err != nil {
-		return token, err
+		return ctx, nil, err
+	}
+
+	principal := &Principal{
+		Provider:  "firebase",
+		Subject:   token.UID,
+		Issuer:    token.Issuer,
+		Audience:  []string{token.Audience},
+		IssuedAt:  time.Unix(token.IssuedAt, 0),
+		ExpiresAt: time.Unix(token.Expires, 0),
+		AuthTime:  time.Unix(token.AuthTime, 0),
+		Claims:    token.Claims,
 	}
 
-	return token, nil
+	ctx = context.WithValue(ctx, firebaseAuthTokenContextKey{}, token)
+	ctx = WithPrincipal(ctx, principal)
+
+	return ctx, principal, nil
 }
 
 // FirebaseAuthSetUserClaims sets the user with the passed uid's token claims.
@@ -138,6 +105,16 @@ func (a *FirebaseAuth) FirebaseAuthSetUserClaims(ctx context.Context, uid string
 	return client.SetCustomUserClaims(ctx, uid, claims)
 }
 
+// HealthCheck verifies that the Firebase auth API can be reached with the
+// configured credentials. A missing user is treated as healthy.
+func (a *FirebaseAuth) HealthCheck(ctx context.Context) error {
+	_, err := a.authClient.GetUser(ctx, "gqlserver-health-check")
+	if err != nil && !auth.IsUserNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 // FirebaseAuthTokenFromContext retrives the verified Firebase auth token
 // from the current context
 func FirebaseAuthTokenFromContext(ctx context.Context) *auth.Token {
@@ -156,13 +133,3 @@ func FirebaseAuthFromContext(ctx context.Context) *FirebaseAuth {
 	}
 	return firebaseAuth
 }
-
-type cookieTokenExtractor struct{}
-
-func (c cookieTokenExtractor) ExtractToken(r *http.Request) (string, error) {
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		return "", request.ErrNoTokenInRequest
-	}
-	return cookie.Value, nil
-}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang-jwt/jwt/v4/request"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultJWKSAlgorithms are the asymmetric signing algorithms accepted when
+// none are configured
+var DefaultJWKSAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+type jwksAuthTokenContextKey struct{}
+
+// JWKSAuth verifies JWTs signed by keys published in a JSON Web Key Set, such
+// as tokens issued by an OpenID Connect provider like Keycloak or Auth0
+type JWKSAuth struct {
+	issuer       string
+	audience     string
+	clockSkew    time.Duration
+	keys         *keySet
+	parser       *jwt.Parser
+	jwtExtractor request.Extractor
+}
+
+var _ Authenticator = &JWKSAuth{}
+
+// NewJWKSAuth loads the configured key set and starts refreshing it in the
+// background. When no JWKS URL or key file is configured, the URL is
+// discovered from the issuer's OpenID configuration. Key set errors are logged
+// to logger.
+func NewJWKSAuth(cfg AuthConfig, logger *logrus.Entry) (*JWKSAuth, error) {
+	url := cfg.JWKSURL
+	if url == "" && cfg.JWKSKeyFile == "" {
+		if cfg.JWKSIssuer == "" {
+			return nil, errors.New("jwks auth requires a JWKS URL, key file or issuer")
+		}
+
+		discovered, err := discoverJWKSURL(cfg.JWKSIssuer)
+		if err != nil {
+			return nil, err
+		}
+		url = discovered
+	}
+
+	algorithms := cfg.JWKSAllowedAlgorithms
+	if len(algorithms) == 0 {
+		algorithms = DefaultJWKSAlgorithms
+	}
+
+	keys := newKeySet(url, cfg.JWKSKeyFile, logger)
+	if err := keys.refresh(context.Background()); err != nil {
+		return nil, fmt.Errorf("error loading JSON web key set: %w", err)
+	}
+	go keys.run(cfg.JWKSRefreshInterval)
+
+	return &JWKSAuth{
+		issuer:       cfg.JWKSIssuer,
+		audience:     cfg.JWKSAudience,
+		clockSkew:    cfg.JWKSClockSkew,
+		keys:         keys,
+		parser:       jwt.NewParser(jwt.WithValidMethods(algorithms), jwt.WithoutClaimsValidation()),
+		jwtExtractor: defaultExtractor(),
+	}, nil
+}
+
+// Middleware retrieves and verifies a JWT via a header or cookie and passes
+// the resulting Principal into the current context
+func (a *JWKSAuth) Middleware() gin.HandlerFunc {
+	return authMiddleware(a, "jwks", a.jwtExtractor, "Gin/Middleware/JWKSAuth")
+}
+
+// Authenticate verifies the signature and claims of a JWT and passes both the
+// token and the resulting Principal into the returned context
+func (a *JWKSAuth) Authenticate(ctx context.Context, rawToken string) (context.Context, *Principal, error) {
+	claims := jwt.MapClaims{}
+	token, err := a.parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := a.keys.lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key algorithm %s", token.Method.Alg(), key.alg)
+		}
+		return key.key, nil
+	})
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	if err := a.validateClaims(claims); err != nil {
+		return ctx, nil, err
+	}
+
+	principal := &Principal{
+		Provider:  "jwks",
+		Subject:   stringClaim(claims, "sub"),
+		Issuer:    stringClaim(claims, "iss"),
+		Audience:  audienceClaim(claims),
+		IssuedAt:  timeClaim(claims, "iat"),
+		ExpiresAt: timeClaim(claims, "exp"),
+		AuthTime:  timeClaim(claims, "auth_time"),
+		Claims:    claims,
+	}
+
+	ctx = context.WithValue(ctx, jwksAuthTokenContextKey{}, token)
+	ctx = WithPrincipal(ctx, principal)
+
+	return ctx, principal, nil
+}
+
+// HealthCheck reports whether any verification keys are loaded
+func (a *JWKSAuth) HealthCheck(ctx context.Context) error {
+	if a.keys.size() == 0 {
+		return errors.New("no JSON web keys loaded")
+	}
+	return nil
+}
+
+// Close stops refreshing the key set in the background
+func (a *JWKSAuth) Close() error {
+	a.keys.close()
+	return nil
+}
+
+func (a *JWKSAuth) validateClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+
+	if !claims.VerifyExpiresAt(now.Add(-a.clockSkew).Unix(), true) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(a.clockSkew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(a.clockSkew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return errors.New("token has invalid issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return errors.New("token has invalid audience")
+	}
+
+	return nil
+}
+
+// JWKSAuthTokenFromContext retrieves the verified JWT from the current context
+func JWKSAuthTokenFromContext(ctx context.Context) *jwt.Token {
+	token, ok := ctx.Value(jwksAuthTokenContextKey{}).(*jwt.Token)
+	if !ok {
+		return nil
+	}
+	return token
+}
+
+// discoverJWKSURL reads the jwks_uri from an issuer's OpenID configuration
+func discoverJWKSURL(issuer string) (string, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("error discovering OpenID configuration: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error discovering OpenID configuration: unexpected status %s", res.Status)
+	}
+
+	var configuration struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&configuration); err != nil {
+		return "", fmt.Errorf("error decoding OpenID configuration: %w", err)
+	}
+	if configuration.JWKSURI == "" {
+		return "", errors.New("OpenID configuration has no jwks_uri")
+	}
+
+	return configuration.JWKSURI, nil
+}
+
+func stringClaim(claims jwt.MapClaims, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+func timeClaim(claims jwt.MapClaims, key string) time.Time {
+	switch v := claims[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0)
+	case json.Number:
+		i, _ := v.Int64()
+		return time.Unix(i, 0)
+	}
+	return time.Time{}
+}
+
+func audienceClaim(claims jwt.MapClaims) []string {
+	switch v := claims["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		audience := make([]string, 0, len(v))
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
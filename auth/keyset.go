@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// minKeyRefreshInterval limits how often an unknown key ID can trigger a refresh
+const minKeyRefreshInterval = 30 * time.Second
+
+var errKeyNotFound = errors.New("signing key not found")
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet caches the public keys used to verify tokens. Keys fetched from a URL
+// are refreshed in the background, picking up rotated keys as they are published.
+type keySet struct {
+	url    string
+	file   string
+	client *http.Client
+	logger *logrus.Entry
+
+	mu          sync.RWMutex
+	keys        map[string]verificationKey
+	lastRefresh time.Time
+
+	refreshMu sync.Mutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newKeySet(url, file string, logger *logrus.Entry) *keySet {
+	return &keySet{
+		url:    url,
+		file:   file,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		keys:   map[string]verificationKey{},
+		stop:   make(chan struct{}),
+	}
+}
+
+// refresh reloads every key, replacing the previous set
+func (k *keySet) refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	return k.refreshLocked(ctx)
+}
+
+// refreshIfStale refreshes the key set unless it was refreshed within
+// minKeyRefreshInterval. Concurrent callers wait for a single refresh
+func (k *keySet) refreshIfStale(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	k.mu.RLock()
+	stale := time.Since(k.lastRefresh) > minKeyRefreshInterval
+	k.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+	return k.refreshLocked(ctx)
+}
+
+// refreshLocked reloads the keys, and must be called holding refreshMu
+func (k *keySet) refreshLocked(ctx context.Context) error {
+	var keys map[string]verificationKey
+	var err error
+	if k.file != "" {
+		keys, err = loadKeyFile(k.file, k.logger)
+	} else {
+		keys, err = k.fetch(ctx)
+	}
+
+	k.mu.Lock()
+	k.lastRefresh = time.Now()
+	if err == nil {
+		k.keys = keys
+	}
+	k.mu.Unlock()
+
+	return err
+}
+
+// run refreshes the key set at interval until the key set is closed
+func (k *keySet) run(interval time.Duration) {
+	if interval <= 0 || k.url == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			if err := k.refresh(context.Background()); err != nil {
+				k.logger.WithError(err).Error("error refreshing JSON web key set")
+			}
+		}
+	}
+}
+
+func (k *keySet) close() {
+	k.stopOnce.Do(func() {
+		close(k.stop)
+	})
+}
+
+// lookup finds the key for kid. An unknown kid triggers a refresh in case the
+// provider has rotated its keys, at most once per minKeyRefreshInterval however
+// many unknown kids are seen.
+func (k *keySet) lookup(ctx context.Context, kid string) (verificationKey, error) {
+	if key, ok := k.find(kid); ok {
+		return key, nil
+	}
+
+	if k.url != "" {
+		if err := k.refreshIfStale(ctx); err != nil {
+			return verificationKey{}, err
+		}
+		// the key may have been loaded by this or a concurrent refresh
+		if key, ok := k.find(kid); ok {
+			return key, nil
+		}
+	}
+
+	return verificationKey{}, fmt.Errorf("%w: kid %q", errKeyNotFound, kid)
+}
+
+func (k *keySet) find(kid string) (verificationKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, true
+	}
+	// tokens without a kid can only be verified when there is a single key
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	return verificationKey{}, false
+}
+
+func (k *keySet) size() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+func (k *keySet) fetch(ctx context.Context) (map[string]verificationKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JSON web key set: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JSON web key set: unexpected status %s", res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetching JSON web key set: %w", err)
+	}
+
+	return parseKeySet(body, k.logger)
+}
+
+// loadKeyFile reads either a JSON web key set or a single PEM encoded public
+// key or certificate. A PEM key is stored without a kid.
+func loadKeyFile(path string, logger *logrus.Entry) (map[string]verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		return parseKeySet(data, logger)
+	}
+
+	var key crypto.PublicKey
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key = rsaKey
+	} else if ecKey, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		key = ecKey
+	} else if edKey, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key = edKey
+	} else {
+		return nil, fmt.Errorf("unsupported PEM public key in %s", path)
+	}
+
+	return map[string]verificationKey{
+		"": {key: key},
+	}, nil
+}
+
+func parseKeySet(data []byte, logger *logrus.Entry) (map[string]verificationKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding JSON web key set: %w", err)
+	}
+
+	keys := map[string]verificationKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// skip keys which can't be used rather than rejecting the whole set
+			logger.WithError(err).WithField("kid", jwk.Kid).Warn("skipping JSON web key")
+			continue
+		}
+
+		keys[jwk.Kid] = verificationKey{
+			alg: jwk.Alg,
+			key: key,
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JSON web key set contains no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestKeySetLookupCollapsesRefreshes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := json.Marshal(jsonWebKeySet{Keys: []jsonWebKey{{
+		Kty: "RSA",
+		Kid: "known",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(set)
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	keys := newKeySet(server.URL, "", logrus.NewEntry(logger))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys.lookup(context.Background(), fmt.Sprintf("unknown-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected 1 key set fetch for concurrent unknown kids, got %d", n)
+	}
+
+	if _, err := keys.lookup(context.Background(), "known"); err != nil {
+		t.Fatalf("expected known kid to be found: %v", err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected known kid to be found without a fetch, got %d fetches", n)
+	}
+}
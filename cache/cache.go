@@ -0,0 +1,15 @@
+package cache
+
+import "context"
+
+// Entry is a key and value held by a cache
+type Entry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Lister is implemented by caches which can list their entries
+type Lister interface {
+	// Entries returns up to limit entries, in no particular order
+	Entries(ctx context.Context, limit int) ([]Entry, error)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// LRU is an in memory cache which evicts the least recently used entries.
+// Unlike the gqlgen LRU, its entries can be listed
+type LRU struct {
+	lru *lru.Cache
+}
+
+var _ interface {
+	graphql.Cache
+	Lister
+} = &LRU{}
+
+// NewLRU creates a cache holding up to size entries
+func NewLRU(size int) (*LRU, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache: %w", err)
+	}
+	return &LRU{lru: cache}, nil
+}
+
+func (l *LRU) Get(ctx context.Context, key string) (interface{}, bool) {
+	return l.lru.Get(key)
+}
+
+func (l *LRU) Add(ctx context.Context, key string, value interface{}) {
+	l.lru.Add(key, value)
+}
+
+func (l *LRU) Entries(ctx context.Context, limit int) ([]Entry, error) {
+	keys := l.lru.Keys()
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		// entries may be evicted while they are listed
+		if value, ok := l.lru.Peek(key); ok {
+			entries = append(entries, Entry{Key: key.(string), Value: value})
+		}
+	}
+	return entries, nil
+}
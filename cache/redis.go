@@ -2,7 +2,14 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	redis "github.com/go-redis/redis/v8"
@@ -16,21 +23,162 @@ type RedisCache struct {
 
 const apqPrefix = "apq:"
 
-func NewRedis(redisAddress string, appPrefix string, ttl time.Duration) *RedisCache {
-	client := redis.NewClient(&redis.Options{
-		Addr: redisAddress,
-	})
+// sharedAppPrefix is the app prefix of queries shared by every service, which
+// makes keys "apq:apq::<hash>"
+const sharedAppPrefix = apqPrefix
 
-	err := client.Ping(context.Background()).Err()
+// NewRedis connects to a single Redis instance at redisAddress. appPrefix is
+// ignored, queries are always stored under the shared "apq:apq::<hash>" keys.
+//
+// Deprecated: NewRedis panics if Redis can't be reached. Use NewRedisFromConfig instead.
+func NewRedis(redisAddress string, appPrefix string, ttl time.Duration) *RedisCache {
+	cache, err := NewRedisFromConfig(RedisConfig{
+		Addresses: []string{redisAddress},
+	}, "", ttl)
 	if err != nil {
 		log.Panicf("could not create cache: %v", err)
 	}
 
+	return cache
+}
+
+// NewRedisFromConfig connects to Redis and verifies the connection
+func NewRedisFromConfig(cfg RedisConfig, appPrefix string, ttl time.Duration) (*RedisCache, error) {
+	client, err := NewRedisClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache: %w", err)
+	}
+
+	return NewRedisCache(client, appPrefix, ttl), nil
+}
+
+// NewRedisCache creates a cache using an existing Redis client. Queries are
+// stored under "apq:apq::<hash>", shared by every service using the Redis
+// instance, unless appPrefix is set. They are then stored under
+// "apq:<appPrefix>:<hash>" so that services sharing Redis don't share
+// persisted queries
+func NewRedisCache(client redis.UniversalClient, appPrefix string, ttl time.Duration) *RedisCache {
+	if appPrefix == "" {
+		appPrefix = sharedAppPrefix
+	}
+
 	return &RedisCache{
 		client:    client,
 		ttl:       ttl,
-		appPrefix: apqPrefix + ":",
+		appPrefix: appPrefix + ":",
+	}
+}
+
+// NewRedisClient creates a Redis client for a single node, a cluster or
+// a Sentinel managed master depending on cfg, and verifies the connection
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	opts, err := cfg.universalOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var client redis.UniversalClient
+	if cfg.Cluster && opts.MasterName == "" {
+		client = redis.NewClusterClient(opts.Cluster())
+	} else {
+		client = redis.NewUniversalClient(opts)
+	}
+
+	timeout := cfg.DialTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to redis: %w", err)
+	}
+
+	return client, nil
+}
+
+func (cfg RedisConfig) universalOptions() (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{}
+
+	if cfg.URL != "" {
+		parsed, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		opts.Addrs = []string{parsed.Addr}
+		opts.Username = parsed.Username
+		opts.Password = parsed.Password
+		opts.DB = parsed.DB
+		opts.TLSConfig = parsed.TLSConfig
+	}
+
+	if len(cfg.Addresses) > 0 {
+		opts.Addrs = cfg.Addresses
+	}
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("redis requires a URL or at least one address")
+	}
+
+	if cfg.Username != "" {
+		opts.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		opts.Password = cfg.Password
 	}
+	if cfg.DB != 0 {
+		opts.DB = cfg.DB
+	}
+
+	opts.MasterName = cfg.SentinelMasterName
+	opts.SentinelUsername = cfg.SentinelUsername
+	opts.SentinelPassword = cfg.SentinelPassword
+
+	opts.PoolSize = cfg.PoolSize
+	opts.MinIdleConns = cfg.MinIdleConns
+	opts.PoolTimeout = cfg.PoolTimeout
+	opts.DialTimeout = cfg.DialTimeout
+	opts.ReadTimeout = cfg.ReadTimeout
+	opts.WriteTimeout = cfg.WriteTimeout
+	opts.MaxRetries = cfg.MaxRetries
+
+	if cfg.TLSEnabled || cfg.TLSCAFile != "" || cfg.TLSServerName != "" || cfg.TLSInsecureSkipVerify {
+		tlsConfig, err := cfg.tlsConfig(opts.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return opts, nil
+}
+
+func (cfg RedisConfig) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+
+	if cfg.TLSServerName != "" {
+		tlsConfig.ServerName = cfg.TLSServerName
+	}
+	tlsConfig.InsecureSkipVerify = cfg.TLSInsecureSkipVerify
+
+	if cfg.TLSCAFile != "" {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read redis CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
 }
 
 func (c *RedisCache) Add(ctx context.Context, key string, value interface{}) {
@@ -45,6 +193,70 @@ func (c *RedisCache) Get(ctx context.Context, key string) (interface{}, bool) {
 	return s, true
 }
 
+// Ping checks the connection to Redis
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Client returns the underlying Redis client so it can be shared
+func (c *RedisCache) Client() redis.UniversalClient {
+	return c.client
+}
+
+// Entries scans Redis for persisted queries, on every master of a cluster
+func (c *RedisCache) Entries(ctx context.Context, limit int) ([]Entry, error) {
+	prefix := buildKey(c.appPrefix, "")
+
+	var mu sync.Mutex
+	var keys []string
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			full := limit > 0 && len(keys) >= limit
+			if !full {
+				keys = append(keys, iter.Val())
+			}
+			mu.Unlock()
+			if full {
+				break
+			}
+		}
+		return iter.Err()
+	}
+
+	var err error
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, c.client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are read one by one as they may be in different cluster slots
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(keys))
+	for i, cmd := range cmds {
+		// entries may expire while they are listed
+		if value, err := cmd.Result(); err == nil {
+			entries = append(entries, Entry{Key: strings.TrimPrefix(keys[i], prefix), Value: value})
+		}
+	}
+	return entries, nil
+}
+
 func buildKey(appPrefix, key string) string {
 	return apqPrefix + appPrefix + key
 }
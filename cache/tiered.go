@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/sync/singleflight"
+)
+
+const invalidationSuffix = "invalidate"
+
+// remoteLookupTimeout limits a Redis lookup shared by concurrent misses
+const remoteLookupTimeout = 5 * time.Second
+
+type TieredConfig struct {
+	// Maximum number of entries held in memory
+	LocalSize int
+
+	// Time entries are held in memory before they are read from Redis again,
+	// 0 keeps entries until they are evicted
+	LocalTTL time.Duration
+
+	// Invalidate entries held in memory by other replicas when an entry is
+	// added, using Redis pub/sub
+	Invalidation bool
+}
+
+// TieredStats counts lookups by tier. Remote lookups are only made after a
+// local miss, and concurrent misses for the same key share one remote lookup
+type TieredStats struct {
+	LocalHits    uint64
+	LocalMisses  uint64
+	RemoteHits   uint64
+	RemoteMisses uint64
+}
+
+// Tiered is a cache which holds recently used entries in memory in front of Redis
+type Tiered struct {
+	remote *RedisCache
+	local  *lru.Cache
+	ttl    time.Duration
+	group  singleflight.Group
+
+	// id identifies invalidations published by this instance
+	id      string
+	channel string
+	pubsub  *redis.PubSub
+	wg      sync.WaitGroup
+
+	localHits    atomic.Uint64
+	localMisses  atomic.Uint64
+	remoteHits   atomic.Uint64
+	remoteMisses atomic.Uint64
+}
+
+type localEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewTiered creates a cache in front of remote. When invalidation is enabled
+// the cache subscribes to a channel shared by every replica using the same
+// Redis and app prefix, and must be closed when no longer used
+func NewTiered(remote *RedisCache, cfg TieredConfig) (*Tiered, error) {
+	local, err := lru.New(cfg.LocalSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not create tiered cache: %w", err)
+	}
+
+	id, err := instanceID()
+	if err != nil {
+		return nil, fmt.Errorf("could not create tiered cache: %w", err)
+	}
+
+	t := &Tiered{
+		remote:  remote,
+		local:   local,
+		ttl:     cfg.LocalTTL,
+		id:      id,
+		channel: buildKey(remote.appPrefix, invalidationSuffix),
+	}
+
+	if cfg.Invalidation {
+		ctx := context.Background()
+		t.pubsub = remote.client.Subscribe(ctx, t.channel)
+		// wait for the subscription to be confirmed so no invalidations are missed
+		if _, err := t.pubsub.Receive(ctx); err != nil {
+			t.pubsub.Close()
+			return nil, fmt.Errorf("could not subscribe to cache invalidations: %w", err)
+		}
+
+		t.wg.Add(1)
+		go t.receiveInvalidations()
+	}
+
+	return t, nil
+}
+
+func (t *Tiered) Add(ctx context.Context, key string, value interface{}) {
+	t.addLocal(key, value)
+	t.remote.Add(ctx, key, value)
+
+	if t.pubsub != nil {
+		t.remote.client.Publish(ctx, t.channel, t.id+"|"+key)
+	}
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (interface{}, bool) {
+	if value, ok := t.getLocal(key); ok {
+		t.localHits.Add(1)
+		return value, true
+	}
+	t.localMisses.Add(1)
+
+	// the lookup is shared by every caller, so it must not be cancelled by
+	// the caller which started it
+	result := t.group.DoChan(key, func() (interface{}, error) {
+		lookupCtx, cancel := context.WithTimeout(context.Background(), remoteLookupTimeout)
+		defer cancel()
+
+		value, ok := t.remote.Get(lookupCtx, key)
+		if !ok {
+			t.remoteMisses.Add(1)
+			return nil, nil
+		}
+
+		t.remoteHits.Add(1)
+		t.addLocal(key, value)
+		return value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return struct{}{}, false
+	case res := <-result:
+		if res.Val == nil {
+			return struct{}{}, false
+		}
+		return res.Val, true
+	}
+}
+
+// Entries lists the entries in Redis, which include those held in memory
+func (t *Tiered) Entries(ctx context.Context, limit int) ([]Entry, error) {
+	return t.remote.Entries(ctx, limit)
+}
+
+// Stats returns the number of hits and misses for each tier
+func (t *Tiered) Stats() TieredStats {
+	return TieredStats{
+		LocalHits:    t.localHits.Load(),
+		LocalMisses:  t.localMisses.Load(),
+		RemoteHits:   t.remoteHits.Load(),
+		RemoteMisses: t.remoteMisses.Load(),
+	}
+}
+
+// Ping checks the connection to Redis
+func (t *Tiered) Ping(ctx context.Context) error {
+	return t.remote.Ping(ctx)
+}
+
+// Client returns the underlying Redis client so it can be shared
+func (t *Tiered) Client() redis.UniversalClient {
+	return t.remote.client
+}
+
+// Close stops receiving invalidations. The Redis client is left open
+func (t *Tiered) Close() error {
+	if t.pubsub == nil {
+		return nil
+	}
+
+	err := t.pubsub.Close()
+	t.wg.Wait()
+	return err
+}
+
+func (t *Tiered) getLocal(key string) (interface{}, bool) {
+	v, ok := t.local.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	entry := v.(localEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		t.local.Remove(key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (t *Tiered) addLocal(key string, value interface{}) {
+	entry := localEntry{value: value}
+	if t.ttl > 0 {
+		entry.expires = time.Now().Add(t.ttl)
+	}
+	t.local.Add(key, entry)
+}
+
+// receiveInvalidations removes entries added by other replicas until the
+// subscription is closed
+func (t *Tiered) receiveInvalidations() {
+	defer t.wg.Done()
+
+	for msg := range t.pubsub.Channel() {
+		origin, key, ok := strings.Cut(msg.Payload, "|")
+		if !ok || origin == t.id {
+			continue
+		}
+		t.local.Remove(key)
+	}
+}
+
+func instanceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,12 +1,29 @@
 package gqlserver
 
 import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/caarlos0/env/v6"
-	"github.com/joho/godotenv"
 	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/cache"
+	"github.com/maxtroughear/gqlserver/graphql/budget"
+	"github.com/maxtroughear/gqlserver/graphql/gqllogrus"
+	"github.com/maxtroughear/gqlserver/graphql/limits"
 	"github.com/maxtroughear/gqlserver/graphql/nrextension"
+	"github.com/maxtroughear/gqlserver/graphql/otelextension"
+	"github.com/maxtroughear/gqlserver/graphql/promextension"
+	"github.com/maxtroughear/gqlserver/graphql/safelist"
+	"github.com/maxtroughear/gqlserver/health"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/maxtroughear/gqlserver/ratelimit"
+	"github.com/maxtroughear/gqlserver/redact"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,12 +43,27 @@ type ServerConfig struct {
 	// ComplexityLimit of 0 means no limit
 	ComplexityLimit int `env:"COMPLEXITY_LIMIT"`
 
-	// ApqCache for automatic persisted query hashes
+	// Complexity limits and rolling budgets by principal, overriding ComplexityLimit
+	ComplexityBudget budget.Config
+
+	// Limits on the depth, aliases, root fields, directives and tokens of queries,
+	// none of which are set by default
+	Limits limits.Config
+
+	// ApqCache for automatic persisted query hashes.
+	// Built from Cache when loading config from the environment
 	ApqCache graphql.Cache
 
-	// QueryCache
+	// QueryCache for parsed and validated queries.
+	// Built from Cache when loading config from the environment
 	QueryCache graphql.Cache
 
+	// Cache Configuration
+	Cache CacheConfig
+
+	// Redis Configuration, used by caches with the "redis" and "tiered" backends
+	Redis cache.RedisConfig
+
 	// Endpoint for the GraphQL handler
 	GraphqlPath string `env:"GRAPHQL_PATH"`
 
@@ -48,9 +80,47 @@ type ServerConfig struct {
 	// Port to bind HTTP server to
 	Port int `env:"PORT"`
 
+	// TLS Configuration, the server uses plain HTTP when no certificate is set
+	TLS TLSConfig
+
+	// HTTP server Configuration
+	HTTP HTTPConfig
+
+	// Maximum time to wait for in-flight operations and subscriptions to
+	// finish when the server is shutting down
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+
+	// Time to keep serving requests after readiness starts failing during
+	// shutdown, allowing load balancers to stop routing traffic to the server
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY"`
+
 	// Logger minimum level
 	LogLevel logrus.Level `env:"LOG_LEVEL"`
 
+	// Log output format, one of "json", "text" or "logfmt".
+	// "text" is for reading in a terminal, and is colored when writing to one
+	LogFormat string `env:"LOG_FORMAT"`
+
+	// Renames the standard log fields "msg", "level" and "time",
+	// e.g. "msg:message,level:severity"
+	LogFieldMap map[string]string `env:"LOG_FIELD_MAP"`
+
+	// Logger used instead of one built from the log config. Hooks are added
+	// to it but its output, level and format are left unchanged
+	Logger *logrus.Logger
+
+	// Access log Configuration
+	AccessLog middleware.AccessLogConfig
+
+	// Slow operation log Configuration, disabled unless a threshold is set
+	SlowOperationLog gqllogrus.SlowOperationConfig
+
+	// Sensitive fields and text redacted from logs
+	Redact redact.Config
+
+	// Header holding the request ID, which is generated when a request has none
+	RequestIDHeader string `env:"REQUEST_ID_HEADER"`
+
 	// Name of this service to report in logs
 	ServiceName string `env:"SERVICE_NAME"`
 
@@ -58,7 +128,7 @@ type ServerConfig struct {
 	Environment Environment `env:"ENVIRONMENT"`
 
 	// Salt used to generated ID hashes
-	IDHashSalt string `env:"ID_HASH_SALT"`
+	IDHashSalt string `env:"ID_HASH_SALT" secret:"true"`
 
 	// Minimum length of ID hashes
 	IDHashMinLength int `env:"ID_HASH_MIN_LENGTH"`
@@ -66,11 +136,146 @@ type ServerConfig struct {
 	// New Relic Configuration
 	NewRelic NewRelicConfig
 
+	// OpenTelemetry Configuration
+	OpenTelemetry OpenTelemetryConfig
+
+	// Prometheus Configuration
+	Metrics MetricsConfig
+
+	// Trusted documents Configuration
+	Safelist safelist.Config
+
 	// Auth Configuration
 	Auth auth.AuthConfig
 
 	// CORS Configuration
 	Cors CorsConfig
+
+	// Rate limiting Configuration
+	RateLimit RateLimitConfig
+
+	// Networks of proxies trusted to set the client IP in forwarded headers,
+	// e.g. "10.0.0.0/8". No proxies are trusted by default
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// Health and readiness check Configuration
+	Health health.Config
+
+	// Admin Configuration
+	Admin AdminConfig
+
+	// Interval to check the config file for changes to reload, 0 disables
+	// watching the file. The config is also reloaded on SIGHUP
+	ReloadInterval time.Duration `env:"CONFIG_RELOAD_INTERVAL"`
+
+	// sources of values set by LoadConfig, by environment variable
+	sources map[string]string
+
+	// load reads the config again when it is reloaded
+	load *loadOptions
+}
+
+type AdminConfig struct {
+	// Bearer token required by admin routes, which are only protected by the
+	// bind address and client certificates when empty
+	Token string `env:"ADMIN_TOKEN" secret:"true"`
+
+	// Endpoint serving the effective config on the main port, disabled when empty
+	ConfigPath string `env:"ADMIN_CONFIG_PATH"`
+
+	// Port to serve the admin server on, 0 disables the admin server
+	Port int `env:"ADMIN_PORT"`
+
+	// Address to bind the admin server to, e.g. "127.0.0.1".
+	// Addresses other than loopback require a token or client CA
+	Address string `env:"ADMIN_ADDRESS"`
+
+	// Certificate and key to serve the admin server with TLS
+	TLSCertFile string `env:"ADMIN_TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"ADMIN_TLS_KEY_FILE"`
+
+	// CA which must have signed client certificates, requiring mutual TLS
+	ClientCAFile string `env:"ADMIN_CLIENT_CA_FILE"`
+}
+
+type TLSConfig struct {
+	// Certificate and key to serve HTTPS and HTTP/2 with
+	CertFile string `env:"TLS_CERT_FILE"`
+	KeyFile  string `env:"TLS_KEY_FILE"`
+
+	// Interval to check the certificate and key files for changes to reload,
+	// 0 disables reloading
+	ReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL"`
+
+	// Minimum TLS version, one of "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string `env:"TLS_MIN_VERSION"`
+
+	// CA which must have signed client certificates, enabling mutual TLS
+	ClientCAFile string `env:"TLS_CLIENT_CA_FILE"`
+
+	// Client certificate policy when a client CA is set, one of "require" or
+	// "verify-if-given"
+	ClientAuth string `env:"TLS_CLIENT_AUTH"`
+}
+
+type HTTPConfig struct {
+	// Accept HTTP/2 without TLS, for running behind a proxy which speaks
+	// HTTP/2 to its upstreams. Can't be used with TLS
+	H2C bool `env:"HTTP_H2C"`
+
+	// Maximum time to read a request including its body, 0 means no limit
+	ReadTimeout time.Duration `env:"HTTP_READ_TIMEOUT"`
+
+	// Maximum time to read request headers, 0 means no limit
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT"`
+
+	// Maximum time to write a response, 0 means no limit.
+	// Applies to websocket subscriptions, so is best left unset when using them
+	WriteTimeout time.Duration `env:"HTTP_WRITE_TIMEOUT"`
+
+	// Maximum time to keep idle connections open, 0 means ReadTimeout is used
+	IdleTimeout time.Duration `env:"HTTP_IDLE_TIMEOUT"`
+
+	// Maximum size of request headers in bytes
+	MaxHeaderBytes int `env:"HTTP_MAX_HEADER_BYTES"`
+}
+
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+	CacheBackendTiered = "tiered"
+)
+
+type CacheConfig struct {
+	// Backend for automatic persisted queries, one of "none", "memory", "redis" or "tiered".
+	// The "tiered" backend holds recently used queries in memory in front of Redis
+	ApqBackend string `env:"APQ_CACHE_BACKEND"`
+
+	// Maximum number of persisted queries held in memory by the "memory" and "tiered" backends
+	ApqSize int `env:"APQ_CACHE_SIZE"`
+
+	// Time persisted queries are kept by the "redis" and "tiered" backends, 0 means no expiry
+	ApqTTL time.Duration `env:"APQ_CACHE_TTL"`
+
+	// Time persisted queries are held in memory by the "tiered" backend, 0 means until evicted
+	ApqLocalTTL time.Duration `env:"APQ_CACHE_LOCAL_TTL"`
+
+	// Invalidate persisted queries held in memory by other replicas using Redis pub/sub
+	ApqInvalidation bool `env:"APQ_CACHE_INVALIDATION"`
+
+	// Store persisted queries in Redis under "apq:<ServiceName>:<hash>" rather
+	// than "apq:apq::<hash>", which is shared by every service using the same
+	// Redis. Queries stored under the shared keys are missed once after enabling
+	// this, and registered again by clients
+	ApqServiceKeys bool `env:"APQ_CACHE_SERVICE_KEYS"`
+
+	// Backend for parsed queries, one of "none" or "memory".
+	// Parsed queries can't be stored in Redis
+	QueryBackend string `env:"QUERY_CACHE_BACKEND"`
+
+	// Maximum number of parsed queries held by the "memory" backend
+	QuerySize int `env:"QUERY_CACHE_SIZE"`
 }
 
 type NewRelicConfig struct {
@@ -78,19 +283,82 @@ type NewRelicConfig struct {
 	Enabled bool `env:"NEW_RELIC_ENABLED"`
 
 	// License key for New Relic integration
-	LicenseKey string `env:"NEW_RELIC_LICENSE_KEY"`
+	LicenseKey string `env:"NEW_RELIC_LICENSE_KEY" secret:"true"`
 
 	// Whether or not the New Relic account is in the EU region
 	EuRegion bool `env:"NEW_RELIC_EU_REGION"`
 
+	// Log forwarding Configuration
+	Logs NewRelicLogsConfig
+
 	GraphqlExtension nrextension.Config
 }
 
+type OpenTelemetryConfig struct {
+	// Enable OpenTelemetry tracing
+	Enabled bool `env:"OPEN_TELEMETRY_ENABLED"`
+
+	// Exporter for spans, one of "otlp-http", "otlp-grpc" or "stdout"
+	Exporter string `env:"OPEN_TELEMETRY_EXPORTER"`
+
+	// Endpoint of the OTLP collector, e.g. "localhost:4318".
+	// Defaults to the standard OTEL_EXPORTER_OTLP_* variables
+	Endpoint string `env:"OPEN_TELEMETRY_ENDPOINT"`
+
+	// Disable TLS when connecting to the OTLP collector
+	Insecure bool `env:"OPEN_TELEMETRY_INSECURE"`
+
+	// Headers sent to the OTLP collector, e.g. "api-key:secret"
+	Headers map[string]string `env:"OPEN_TELEMETRY_HEADERS" secret:"true"`
+
+	// Fraction of traces to sample, between 0 and 1.
+	// Traces sampled by an upstream service are always recorded
+	SampleRatio float64 `env:"OPEN_TELEMETRY_SAMPLE_RATIO"`
+
+	GraphqlExtension otelextension.Config
+}
+
+type MetricsConfig struct {
+	// Enable Prometheus metrics
+	Enabled bool `env:"METRICS_ENABLED"`
+
+	// Endpoint for the metrics handler
+	Path string `env:"METRICS_PATH"`
+
+	// Port to serve metrics on, separately from the GraphQL handler.
+	// 0 serves metrics on the main port
+	Port int `env:"METRICS_PORT"`
+
+	GraphqlExtension promextension.Config
+}
+
 type CorsConfig struct {
 	// Enable CORS
 	Enabled bool `env:"CORS_ENABLED"`
 
 	AllowOrigins []string `env:"CORS_ALLOW_ORIGINS"`
+
+	// Response headers readable by browsers, in addition to the request ID
+	ExposeHeaders []string `env:"CORS_EXPOSE_HEADERS"`
+}
+
+type RateLimitConfig struct {
+	// Enable rate limiting of GraphQL requests
+	Enabled bool `env:"RATE_LIMIT_ENABLED"`
+
+	// Algorithm, one of "token-bucket" or "sliding-window"
+	Algorithm string `env:"RATE_LIMIT_ALGORITHM"`
+
+	// Backend storing limits, one of "memory" or "redis"
+	Backend string `env:"RATE_LIMIT_BACKEND"`
+
+	// Rules written as "key:limit/period", e.g. "ip:100/1m,uid+operation:10/1s".
+	// Keys are "ip", "uid" or "operation", or several joined with "+"
+	Rules []ratelimit.Rule `env:"RATE_LIMIT_RULES"`
+
+	// Maximum size of a request body read to find the operation name for
+	// "operation" rules. Larger bodies are limited as anonymous operations
+	MaxBodyBytes int64 `env:"RATE_LIMIT_MAX_BODY_BYTES"`
 }
 
 var DefaultConfig = ServerConfig{
@@ -103,37 +371,390 @@ var DefaultConfig = ServerConfig{
 	PlaygroundEnabled:           false,
 	IntrospectionEnabled:        false,
 	Port:                        3000,
+	ShutdownTimeout:             30 * time.Second,
+	ShutdownDelay:               0,
+	ReloadInterval:              10 * time.Second,
 	LogLevel:                    logrus.InfoLevel,
+	LogFormat:                   LogFormatJSON,
+	RequestIDHeader:             middleware.DefaultRequestIDHeader,
 	ServiceName:                 "unnamed",
 	Environment:                 Dev,
 	IDHashSalt:                  "notasecret",
 	IDHashMinLength:             7,
+	Cache: CacheConfig{
+		ApqBackend:   CacheBackendMemory,
+		ApqSize:      100,
+		ApqTTL:       24 * time.Hour,
+		ApqLocalTTL:  time.Hour,
+		QueryBackend: CacheBackendMemory,
+		QuerySize:    1000,
+	},
+	Redis: cache.RedisConfig{
+		DialTimeout: 5 * time.Second,
+	},
 	NewRelic: NewRelicConfig{
 		Enabled:  false,
 		EuRegion: false,
+		Logs: NewRelicLogsConfig{
+			MinLevel:   logrus.InfoLevel,
+			BufferSize: 4096,
+			DropPolicy: NrLogDropNewest,
+		},
 		GraphqlExtension: nrextension.Config{
 			NoticeErrorOnResolverPanic: true,
 			NoticeErrorOnGraphQLError:  true,
 		},
 	},
+	OpenTelemetry: OpenTelemetryConfig{
+		Enabled:     false,
+		Exporter:    "otlp-http",
+		SampleRatio: 1,
+		GraphqlExtension: otelextension.Config{
+			RecordDocument: false,
+		},
+	},
+	Metrics: MetricsConfig{
+		Enabled: false,
+		Path:    "/metrics",
+		Port:    0,
+		GraphqlExtension: promextension.Config{
+			MaxOperationNames: 100,
+			ResolverDurations: true,
+		},
+	},
+	ComplexityBudget: budget.Config{
+		BudgetWindow:  0,
+		BudgetBackend: budget.BackendMemory,
+	},
+	Safelist: safelist.Config{
+		Mode:           safelist.ModeOff,
+		ReloadInterval: time.Minute,
+	},
 	Auth: auth.AuthConfig{
-		FirebaseEnabled: false,
+		FirebaseEnabled:       false,
+		JWKSEnabled:           false,
+		JWKSAllowedAlgorithms: auth.DefaultJWKSAlgorithms,
+		JWKSClockSkew:         time.Minute,
+		JWKSRefreshInterval:   time.Hour,
 	},
 	Cors: CorsConfig{
 		Enabled:      true,
 		AllowOrigins: []string{"http://localhost:3000"},
 	},
+	TLS: TLSConfig{
+		ReloadInterval: time.Minute,
+		MinVersion:     "1.2",
+		ClientAuth:     TLSClientAuthRequire,
+	},
+	HTTP: HTTPConfig{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	},
+	Admin: AdminConfig{
+		Address: "127.0.0.1",
+	},
+	Health: health.Config{
+		CheckTimeout: 2 * time.Second,
+		CacheTTL:     5 * time.Second,
+	},
+	AccessLog: middleware.AccessLogConfig{
+		Enabled:       false,
+		SampleRate:    1,
+		SlowThreshold: time.Second,
+		SkipPaths:     []string{"/health", "/ready"},
+	},
+	SlowOperationLog: gqllogrus.SlowOperationConfig{
+		Threshold:    0,
+		TopResolvers: 5,
+	},
+	Redact: redact.Config{
+		Mode:          redact.ModeAuto,
+		Patterns:      redact.DefaultPatterns,
+		ValuePatterns: redact.DefaultValuePatterns,
+	},
+	RateLimit: RateLimitConfig{
+		Enabled:      false,
+		Algorithm:    ratelimit.AlgorithmTokenBucket,
+		Backend:      ratelimit.BackendMemory,
+		MaxBodyBytes: 1 << 20,
+	},
 }
 
+// NewConfigFromEnvironment loads the config with LoadConfig, panicking if
+// it is invalid.
+//
+// Deprecated: use LoadConfig, which returns an error instead of panicking
 func NewConfigFromEnvironment() ServerConfig {
-	godotenv.Load()
-
-	config := DefaultConfig
-
-	err := env.Parse(&config)
+	config, err := LoadConfig()
 	if err != nil {
 		panic(err)
 	}
 
 	return config
 }
+
+// envParsers parse maps, which env doesn't support, from "key:value,key:value"
+var envParsers = map[reflect.Type]env.ParserFunc{
+	reflect.TypeOf(map[string]string{}): func(v string) (interface{}, error) {
+		return parseEnvMap(v, func(s string) (string, error) { return s, nil })
+	},
+	reflect.TypeOf(map[string]int{}): func(v string) (interface{}, error) {
+		return parseEnvMap(v, strconv.Atoi)
+	},
+}
+
+func parseEnvMap[V any](v string, parse func(string) (V, error)) (map[string]V, error) {
+	m := map[string]V{}
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid map entry %q, expected key:value", pair)
+		}
+
+		parsed, err := parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+		m[strings.TrimSpace(key)] = parsed
+	}
+	return m, nil
+}
+
+// buildCaches creates ApqCache and QueryCache from the Cache configuration
+func (cfg *ServerConfig) buildCaches() error {
+	switch cfg.Cache.ApqBackend {
+	case CacheBackendNone:
+		cfg.ApqCache = nil
+	case CacheBackendMemory:
+		memoryCache, err := cache.NewLRU(cfg.Cache.ApqSize)
+		if err != nil {
+			return err
+		}
+		cfg.ApqCache = memoryCache
+	case CacheBackendRedis:
+		redisCache, err := cache.NewRedisFromConfig(cfg.Redis, cfg.apqAppPrefix(), cfg.Cache.ApqTTL)
+		if err != nil {
+			return err
+		}
+		cfg.ApqCache = redisCache
+	case CacheBackendTiered:
+		redisCache, err := cache.NewRedisFromConfig(cfg.Redis, cfg.apqAppPrefix(), cfg.Cache.ApqTTL)
+		if err != nil {
+			return err
+		}
+		tiered, err := cache.NewTiered(redisCache, cache.TieredConfig{
+			LocalSize:    cfg.Cache.ApqSize,
+			LocalTTL:     cfg.Cache.ApqLocalTTL,
+			Invalidation: cfg.Cache.ApqInvalidation,
+		})
+		if err != nil {
+			return err
+		}
+		cfg.ApqCache = tiered
+	default:
+		return fmt.Errorf("unknown APQ cache backend %q", cfg.Cache.ApqBackend)
+	}
+
+	switch cfg.Cache.QueryBackend {
+	case CacheBackendNone:
+		cfg.QueryCache = nil
+	case CacheBackendMemory:
+		cfg.QueryCache = lru.New(cfg.Cache.QuerySize)
+	default:
+		return fmt.Errorf("unknown query cache backend %q", cfg.Cache.QueryBackend)
+	}
+
+	return nil
+}
+
+// apqAppPrefix returns the app prefix of persisted queries stored in Redis,
+// which is empty when queries are shared between services
+func (cfg *ServerConfig) apqAppPrefix() string {
+	if cfg.Cache.ApqServiceKeys {
+		return cfg.ServiceName
+	}
+	return ""
+}
+
+// ValidationError lists every problem found in a config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that the config makes sense, returning a ValidationError
+// listing every problem found
+func (cfg ServerConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	switch cfg.Environment {
+	case Dev, Test, Staging, Prod:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown environment %q", cfg.Environment))
+	}
+
+	check(cfg.Port > 0 && cfg.Port < 65536, "port %d is out of range", cfg.Port)
+	check(strings.HasPrefix(cfg.GraphqlPath, "/"), "graphql path %q must start with /", cfg.GraphqlPath)
+	check(cfg.PlaygroundPath == "" || strings.HasPrefix(cfg.PlaygroundPath, "/"),
+		"playground path %q must start with /", cfg.PlaygroundPath)
+	check(cfg.ShutdownTimeout >= 0, "shutdown timeout must not be negative")
+
+	check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "TLS requires both a certificate and key file")
+	check(cfg.TLS.ClientCAFile == "" || cfg.TLS.CertFile != "", "TLS client CA requires a certificate and key file")
+	check(cfg.TLS.ReloadInterval >= 0, "TLS reload interval must not be negative")
+	if _, ok := tlsVersions[cfg.TLS.MinVersion]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown TLS version %q", cfg.TLS.MinVersion))
+	}
+	switch cfg.TLS.ClientAuth {
+	case TLSClientAuthRequire, TLSClientAuthVerifyIfGiven:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown TLS client auth %q", cfg.TLS.ClientAuth))
+	}
+	check(!cfg.HTTP.H2C || cfg.TLS.CertFile == "", "h2c can't be used with TLS")
+	check(cfg.HTTP.ReadTimeout >= 0 && cfg.HTTP.ReadHeaderTimeout >= 0 && cfg.HTTP.WriteTimeout >= 0 && cfg.HTTP.IdleTimeout >= 0,
+		"HTTP timeouts must not be negative")
+	check(cfg.HTTP.MaxHeaderBytes >= 0, "HTTP max header bytes must not be negative")
+
+	check(cfg.ShutdownDelay >= 0, "shutdown delay must not be negative")
+	check(cfg.ReloadInterval >= 0, "config reload interval must not be negative")
+	check(cfg.IDHashMinLength >= 0, "ID hash min length must not be negative")
+	check(cfg.Environment != Prod || cfg.IDHashSalt != DefaultConfig.IDHashSalt,
+		"ID hash salt must be changed from the default in %s", Prod)
+
+	if _, err := newLogFormatter(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := redact.New(cfg.Redact); err != nil {
+		problems = append(problems, err.Error())
+	}
+	switch cfg.Redact.Mode {
+	case redact.ModeAuto, redact.ModeOn, redact.ModeOff:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown redact mode %q", cfg.Redact.Mode))
+	}
+	check(cfg.AccessLog.SampleRate >= 0 && cfg.AccessLog.SampleRate <= 1,
+		"access log sample rate must be between 0 and 1")
+
+	check(!cfg.Auth.FirebaseEnabled || cfg.Auth.FirebaseCredentialsFile != "" || cfg.Auth.FirebaseCredentialsJSON != "",
+		"Firebase auth requires a credentials file or JSON")
+	check(!cfg.Auth.JWKSEnabled || cfg.Auth.JWKSIssuer != "" || cfg.Auth.JWKSURL != "" || cfg.Auth.JWKSKeyFile != "",
+		"JWKS auth requires an issuer, URL or key file")
+
+	if cfg.NewRelic.Enabled {
+		check(cfg.NewRelic.LicenseKey != "", "New Relic requires a license key")
+		switch cfg.NewRelic.Logs.DropPolicy {
+		case NrLogDropNewest, NrLogDropOldest:
+		default:
+			problems = append(problems, fmt.Sprintf("unknown New Relic log drop policy %q", cfg.NewRelic.Logs.DropPolicy))
+		}
+	}
+
+	if cfg.OpenTelemetry.Enabled {
+		switch cfg.OpenTelemetry.Exporter {
+		case OtelExporterOtlpHTTP, OtelExporterOtlpGRPC, OtelExporterStdout:
+		default:
+			problems = append(problems, fmt.Sprintf("unknown OpenTelemetry exporter %q", cfg.OpenTelemetry.Exporter))
+		}
+		check(cfg.OpenTelemetry.SampleRatio >= 0 && cfg.OpenTelemetry.SampleRatio <= 1,
+			"OpenTelemetry sample ratio must be between 0 and 1")
+	}
+
+	check(cfg.Admin.ConfigPath == "" || strings.HasPrefix(cfg.Admin.ConfigPath, "/"),
+		"admin config path %q must start with /", cfg.Admin.ConfigPath)
+	check(cfg.Admin.ConfigPath == "" || cfg.Admin.Token != "", "admin config path requires an admin token")
+	if cfg.Admin.Port != 0 {
+		check(cfg.Admin.Port > 0 && cfg.Admin.Port < 65536, "admin port %d is out of range", cfg.Admin.Port)
+		check(cfg.Admin.Port != cfg.Port && cfg.Admin.Port != cfg.Metrics.Port,
+			"admin port must differ from the server and metrics ports")
+		check((cfg.Admin.TLSCertFile == "") == (cfg.Admin.TLSKeyFile == ""),
+			"admin TLS requires both a certificate and key file")
+		check(cfg.Admin.ClientCAFile == "" || cfg.Admin.TLSCertFile != "",
+			"admin client CA requires a TLS certificate and key file")
+		check(loopbackAddress(cfg.Admin.Address) || cfg.Admin.Token != "" || cfg.Admin.ClientCAFile != "",
+			"admin address %q is not loopback, so requires an admin token or client CA", cfg.Admin.Address)
+	}
+
+	check(!cfg.Metrics.Enabled || strings.HasPrefix(cfg.Metrics.Path, "/"),
+		"metrics path %q must start with /", cfg.Metrics.Path)
+	check(cfg.Metrics.Port >= 0 && cfg.Metrics.Port < 65536, "metrics port %d is out of range", cfg.Metrics.Port)
+	check(!cfg.Metrics.Enabled || cfg.Metrics.Port != cfg.Port, "metrics port must differ from the server port")
+
+	usesRedis := false
+	switch cfg.Cache.ApqBackend {
+	case CacheBackendNone, CacheBackendMemory:
+	case CacheBackendRedis, CacheBackendTiered:
+		usesRedis = true
+	default:
+		problems = append(problems, fmt.Sprintf("unknown APQ cache backend %q", cfg.Cache.ApqBackend))
+	}
+	switch cfg.Cache.QueryBackend {
+	case CacheBackendNone, CacheBackendMemory:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown query cache backend %q", cfg.Cache.QueryBackend))
+	}
+
+	switch cfg.Safelist.Mode {
+	case safelist.ModeOff, "":
+	case safelist.ModeLog, safelist.ModeEnforce:
+		check(cfg.Safelist.ManifestPath != "" || cfg.Safelist.ManifestRedisKey != "",
+			"safelist requires a manifest path or redis key")
+		usesRedis = usesRedis || cfg.Safelist.ManifestPath == "" && cfg.Safelist.ManifestRedisKey != ""
+	default:
+		problems = append(problems, fmt.Sprintf("unknown safelist mode %q", cfg.Safelist.Mode))
+	}
+
+	check(cfg.ComplexityBudget.BudgetWindow >= 0, "complexity budget window must not be negative")
+	if cfg.ComplexityBudget.BudgetWindow > 0 {
+		switch cfg.ComplexityBudget.BudgetBackend {
+		case budget.BackendMemory:
+		case budget.BackendRedis:
+			usesRedis = true
+		default:
+			problems = append(problems, fmt.Sprintf("unknown complexity budget backend %q", cfg.ComplexityBudget.BudgetBackend))
+		}
+	}
+
+	if cfg.RateLimit.Enabled {
+		switch cfg.RateLimit.Algorithm {
+		case ratelimit.AlgorithmTokenBucket, ratelimit.AlgorithmSlidingWindow:
+		default:
+			problems = append(problems, fmt.Sprintf("unknown rate limit algorithm %q", cfg.RateLimit.Algorithm))
+		}
+		switch cfg.RateLimit.Backend {
+		case ratelimit.BackendMemory:
+		case ratelimit.BackendRedis:
+			usesRedis = true
+		default:
+			problems = append(problems, fmt.Sprintf("unknown rate limit backend %q", cfg.RateLimit.Backend))
+		}
+		check(len(cfg.RateLimit.Rules) > 0, "rate limiting requires at least one rule")
+		for _, rule := range cfg.RateLimit.Rules {
+			if _, err := rateLimitKey(rule.Key, cfg.RateLimit); err != nil {
+				problems = append(problems, err.Error())
+			}
+			check(rule.Limit > 0 && rule.Period > 0, "rate limit rule %q requires a positive limit and period", rule.String())
+		}
+		check(cfg.RateLimit.MaxBodyBytes > 0, "rate limit max body bytes must be positive")
+	}
+
+	check(!usesRedis || cfg.Redis.URL != "" || len(cfg.Redis.Addresses) > 0,
+		"Redis requires a URL or addresses")
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package gqlserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maxtroughear/gqlserver/ratelimit"
+)
+
+func TestValidateReportsBudgetAndRateLimitProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *ServerConfig)
+		problem string
+	}{
+		{
+			name: "unknown budget backend",
+			modify: func(cfg *ServerConfig) {
+				cfg.ComplexityBudget.BudgetWindow = time.Minute
+				cfg.ComplexityBudget.BudgetBackend = "disk"
+			},
+			problem: `unknown complexity budget backend "disk"`,
+		},
+		{
+			name: "unknown rate limit key",
+			modify: func(cfg *ServerConfig) {
+				cfg.RateLimit.Enabled = true
+				cfg.RateLimit.Rules = []ratelimit.Rule{{Key: "ip+country", Limit: 10, Period: time.Second}}
+			},
+			problem: `unknown rate limit key "country"`,
+		},
+		{
+			name: "zero rate limit",
+			modify: func(cfg *ServerConfig) {
+				cfg.RateLimit.Enabled = true
+				cfg.RateLimit.Rules = []ratelimit.Rule{{Key: "ip", Period: time.Second}}
+			},
+			problem: `rate limit rule "ip:0/1s" requires a positive limit and period`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig
+			tt.modify(&cfg)
+
+			var validationErr *ValidationError
+			if err := cfg.Validate(); !errors.As(err, &validationErr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if len(validationErr.Problems) != 1 || validationErr.Problems[0] != tt.problem {
+				t.Fatalf("expected problem %q, got %q", tt.problem, validationErr.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package gqlserver
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of config values
+const (
+	ConfigSourceDefault  = "default"
+	ConfigSourceFile     = "file"
+	ConfigSourceEnv      = "env"
+	ConfigSourceOverride = "override"
+	ConfigSourceAdmin    = "admin"
+)
+
+const maskedConfigValue = "******"
+
+// ConfigValue is a setting of the effective config, formatted as it would be
+// set in the environment
+type ConfigValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// Effective returns every setting of the config with the source of its value,
+// which is only known for configs built by LoadConfig. The values of fields
+// tagged `secret:"true"` are masked unless empty
+func (cfg ServerConfig) Effective() []ConfigValue {
+	values := configValues(cfg)
+	for i := range values {
+		if source, ok := cfg.sources[values[i].Key]; ok {
+			values[i].Source = source
+		}
+		if values[i].Secret && values[i].Value != "" {
+			values[i].Value = maskedConfigValue
+		}
+	}
+	return values
+}
+
+// configValues formats the settings of the config, in the order of its fields
+func configValues(cfg ServerConfig) []ConfigValue {
+	var values []ConfigValue
+	addConfigValues(reflect.ValueOf(cfg), &values)
+	return values
+}
+
+func addConfigValues(v reflect.Value, values *[]ConfigValue) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if tag := field.Tag.Get("env"); tag != "" {
+			key, _, _ := strings.Cut(tag, ",")
+			*values = append(*values, ConfigValue{
+				Key:    key,
+				Value:  formatConfigValue(v.Field(i)),
+				Source: ConfigSourceDefault,
+				Secret: field.Tag.Get("secret") == "true",
+			})
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			addConfigValues(v.Field(i), values)
+		}
+	}
+}
+
+// formatConfigValue formats v as it would be parsed from the environment
+func formatConfigValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatConfigValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, fmt.Sprint(iter.Key().Interface())+":"+formatConfigValue(iter.Value()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// configSources records the source of values set by env
+func configSources(sources map[string]string, source string) func(key string, value interface{}, isDefault bool) {
+	return func(key string, value interface{}, isDefault bool) {
+		if value != "" && !isDefault {
+			sources[key] = source
+		}
+	}
+}
+
+// overriddenSources records values changed by overrides
+func overriddenSources(sources map[string]string, before, after []ConfigValue) {
+	for i := range after {
+		if after[i].Value != before[i].Value {
+			sources[after[i].Key] = ConfigSourceOverride
+		}
+	}
+}
+
+// configHandler serves the effective config, and must be protected by adminAuth
+func (s *Server) configHandler() gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		ginContext.JSON(http.StatusOK, gin.H{
+			"config": s.reloader.current().Effective(),
+		})
+	}
+}
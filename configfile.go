@@ -0,0 +1,218 @@
+package gqlserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv is the environment variable holding the path of the config
+// file, when no path is passed to LoadConfig
+const ConfigFileEnv = "CONFIG_FILE"
+
+type loadOptions struct {
+	file      string
+	overrides []func(*ServerConfig)
+}
+
+type LoadOption func(*loadOptions)
+
+// WithConfigFile reads config from a YAML, TOML or JSON file, chosen by
+// its extension
+func WithConfigFile(path string) LoadOption {
+	return func(o *loadOptions) {
+		o.file = path
+	}
+}
+
+// WithOverrides changes the config after it is read from the file and
+// environment, before it is validated
+func WithOverrides(override func(*ServerConfig)) LoadOption {
+	return func(o *loadOptions) {
+		o.overrides = append(o.overrides, override)
+	}
+}
+
+// LoadConfig builds the config in layers, starting from DefaultConfig, then
+// the config file, then environment variables including those in .env, then
+// any overrides. The config file holds the same keys as the environment,
+// e.g. "PORT: 3000", with lists and maps in place of comma separated values.
+// The config is validated before its caches are built. Servers using the
+// config can reload it with Server.Reload
+func LoadConfig(opts ...LoadOption) (ServerConfig, error) {
+	godotenv.Load()
+
+	o := &loadOptions{
+		file: os.Getenv(ConfigFileEnv),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	config, err := loadConfig(o)
+	if err != nil {
+		return config, err
+	}
+
+	if err := config.buildCaches(); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// loadConfig reads and validates the config without building its caches,
+// so that it can be reloaded
+func loadConfig(o *loadOptions) (ServerConfig, error) {
+	config := DefaultConfig
+	config.sources = map[string]string{}
+	config.load = o
+
+	if o.file != "" {
+		vars, err := readConfigFile(o.file)
+		if err != nil {
+			return config, err
+		}
+
+		err = env.ParseWithFuncs(&config, envParsers, env.Options{
+			Environment: vars,
+			OnSet:       configSources(config.sources, ConfigSourceFile),
+		})
+		if err != nil {
+			return config, fmt.Errorf("config file %s: %w", o.file, err)
+		}
+	}
+
+	err := env.ParseWithFuncs(&config, envParsers, env.Options{
+		OnSet: configSources(config.sources, ConfigSourceEnv),
+	})
+	if err != nil {
+		return config, err
+	}
+
+	if len(o.overrides) > 0 {
+		before := configValues(config)
+		for _, override := range o.overrides {
+			override(&config)
+		}
+		overriddenSources(config.sources, before, configValues(config))
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// readConfigFile reads the variables in a config file as strings, in the
+// format they would have in the environment
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	default:
+		return nil, fmt.Errorf("unknown config file format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	known := configKeys()
+
+	vars := make(map[string]string, len(values))
+	var unknown []string
+	for key, value := range values {
+		if _, ok := known[key]; !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		vars[key] = envValue(value)
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	return vars, nil
+}
+
+// envValue formats a value from a config file as an environment variable
+func envValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = envValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(value))
+		for k, v := range value {
+			pairs = append(pairs, k+":"+envValue(v))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// configKeys returns the environment variables read into ServerConfig
+func configKeys() map[string]struct{} {
+	keys := map[string]struct{}{}
+	addConfigKeys(reflect.TypeOf(ServerConfig{}), keys)
+	return keys
+}
+
+func addConfigKeys(t reflect.Type, keys map[string]struct{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if tag := field.Tag.Get("env"); tag != "" {
+			key, _, _ := strings.Cut(tag, ",")
+			keys[key] = struct{}{}
+			continue
+		}
+
+		// env parses nested structs without tags
+		if field.Type.Kind() == reflect.Struct {
+			addConfigKeys(field.Type, keys)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package gqlerrors
+
+import (
+	"errors"
+	"runtime/debug"
+)
+
+// Codes returned in the extensions of GraphQL errors
+const (
+	CodeNotFound        = "NOT_FOUND"
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeBadInput        = "BAD_USER_INPUT"
+	CodeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+const internalMessage = "internal error"
+
+// Error is an error which can be shown to clients, with a code in its
+// extensions. The cause is logged but never shown to clients
+type Error struct {
+	Code       string
+	Message    string
+	Extensions map[string]interface{}
+
+	// Err is the cause of the error
+	Err error
+
+	stack []byte
+}
+
+// New creates an error with a code and a message to show to clients
+func New(code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+func Unauthenticated(message string) *Error {
+	return New(CodeUnauthenticated, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, message)
+}
+
+func BadInput(message string) *Error {
+	return New(CodeBadInput, message)
+}
+
+// Internal wraps an unexpected error, which is masked in production.
+// The stack is recorded so that it can be logged
+func Internal(err error) *Error {
+	return &Error{
+		Code:    CodeInternal,
+		Message: internalMessage,
+		Err:     err,
+		stack:   debug.Stack(),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCause sets the cause of the error
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// WithExtension adds an extension to the error shown to clients
+func (e *Error) WithExtension(key string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]interface{}{}
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// CodeOf returns the code of err, or CodeInternal for errors without a code
+func CodeOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
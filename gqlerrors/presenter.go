@@ -0,0 +1,174 @@
+package gqlerrors
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/graphql/gqllogrus"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Presenter presents errors returned by resolvers to clients.
+//
+// Errors with a code are shown as they are. GraphQL errors created by the
+// application or gqlgen are also shown as they are, as are errors unmarshalling
+// arguments, such as an invalid custom scalar, which are given the
+// BAD_USER_INPUT code. Any other error is unexpected, and is logged and reported
+// to New Relic with a correlation ID which is included in the error shown to clients
+type Presenter struct {
+	// Mask replaces the message of unexpected errors with "internal error"
+	Mask bool
+
+	// Logger is used when there is no logger in the request context
+	Logger *logrus.Entry
+}
+
+// Present is a graphql.ErrorPresenterFunc
+func (p Presenter) Present(ctx context.Context, err error) *gqlerror.Error {
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Code == CodeInternal {
+			return p.internal(ctx, presented, e, e.stack)
+		}
+
+		presented.Message = e.Message
+		presented.Extensions = extensions(e.Extensions, e.Code)
+		return presented
+	}
+
+	// errors created as GraphQL errors are intended to be shown to clients,
+	// wrapped errors were returned by resolvers
+	cause := errors.Unwrap(presented)
+	if cause == nil {
+		return presented
+	}
+
+	// unless they were returned unmarshalling the client's input
+	if argumentError(ctx, presented) {
+		presented.Extensions = extensions(presented.Extensions, CodeBadInput)
+		return presented
+	}
+
+	return p.internal(ctx, presented, cause, nil)
+}
+
+func (p Presenter) internal(ctx context.Context, presented *gqlerror.Error, err error, stack []byte) *gqlerror.Error {
+	correlationID := newCorrelationID()
+
+	fields := logrus.Fields{
+		"correlation.id": correlationID,
+	}
+	if len(presented.Path) > 0 {
+		fields["graphql.path"] = presented.Path.String()
+	}
+	if stack != nil {
+		fields["stack"] = string(stack)
+	}
+	p.logger(ctx).WithError(err).WithFields(fields).Error("internal error")
+
+	if tx := newrelic.FromContext(ctx); tx != nil {
+		tx.NoticeError(newrelic.Error{
+			Message: err.Error(),
+			Class:   CodeInternal,
+			Attributes: map[string]interface{}{
+				"correlation.id": correlationID,
+			},
+		})
+	}
+
+	extensions := extensions(presented.Extensions, CodeInternal)
+	extensions["correlationId"] = correlationID
+
+	if !p.Mask {
+		presented.Extensions = extensions
+		return presented
+	}
+
+	return &gqlerror.Error{
+		Message:    internalMessage,
+		Path:       presented.Path,
+		Extensions: extensions,
+	}
+}
+
+// argumentError reports whether err was returned unmarshalling an argument of
+// the field in ctx. gqlgen reports these errors on the path of the argument
+// before the field's arguments are set
+func argumentError(ctx context.Context, err *gqlerror.Error) bool {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Args != nil || fc.Field.Field == nil || fc.Field.Definition == nil {
+		return false
+	}
+
+	fieldPath := fc.Path()
+	if len(err.Path) <= len(fieldPath) {
+		return false
+	}
+	for i := range fieldPath {
+		if err.Path[i] != fieldPath[i] {
+			return false
+		}
+	}
+
+	name, ok := err.Path[len(fieldPath)].(ast.PathName)
+	return ok && fc.Field.Definition.Arguments.ForName(string(name)) != nil
+}
+
+func (p Presenter) logger(ctx context.Context) *logrus.Entry {
+	if logger := gqllogrus.From(ctx); logger != nil {
+		return logger
+	}
+	if logger := middleware.LogrusFromContext(ctx); logger != nil {
+		return logger
+	}
+	if p.Logger != nil {
+		return p.Logger
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// Recover is a graphql.RecoverFunc which returns a panic as an internal error,
+// so that it is logged with its stack by the Presenter
+func Recover(ctx context.Context, r interface{}) error {
+	return &Error{
+		Code:    CodeInternal,
+		Message: internalMessage,
+		Err:     fmt.Errorf("panic: %v", r),
+		stack:   debug.Stack(),
+	}
+}
+
+// extensions copies the extensions and sets the code
+func extensions(from map[string]interface{}, code string) map[string]interface{} {
+	to := copyExtensions(from, 1)
+	to["code"] = code
+	return to
+}
+
+// copyExtensions copies the extensions, with room for extra more
+func copyExtensions(from map[string]interface{}, extra int) map[string]interface{} {
+	to := make(map[string]interface{}, len(from)+extra)
+	for k, v := range from {
+		to[k] = v
+	}
+	return to
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
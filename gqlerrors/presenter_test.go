@@ -0,0 +1,104 @@
+package gqlerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// email is a custom scalar
+type email string
+
+func (e *email) UnmarshalGQL(v interface{}) error {
+	s, ok := v.(string)
+	if !ok || !strings.Contains(s, "@") {
+		return fmt.Errorf("%v is not a valid email", v)
+	}
+	*e = email(s)
+	return nil
+}
+
+func (e email) MarshalGQL(w io.Writer) {
+	fmt.Fprintf(w, "%q", string(e))
+}
+
+// userFieldContext returns the context of the field user(email: Email!), as
+// created by gqlgen before unmarshalling the field's arguments
+func userFieldContext() context.Context {
+	return graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+		Object: "Query",
+		Field: graphql.CollectedField{
+			Field: &ast.Field{
+				Alias: "user",
+				Name:  "user",
+				Definition: &ast.FieldDefinition{
+					Name: "user",
+					Arguments: ast.ArgumentDefinitionList{
+						{Name: "email", Type: ast.NonNullNamedType("Email", nil)},
+					},
+				},
+			},
+		},
+		IsResolver: true,
+	})
+}
+
+// unmarshalEmailArg unmarshals the email argument as gqlgen generated code does
+func unmarshalEmailArg(ctx context.Context, v interface{}) error {
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("email"))
+
+	var res email
+	err := res.UnmarshalGQL(v)
+	return graphql.ErrorOnPath(ctx, err)
+}
+
+func TestPresentInvalidCustomScalar(t *testing.T) {
+	ctx := userFieldContext()
+	err := unmarshalEmailArg(ctx, "not an email")
+	if err == nil {
+		t.Fatal("expected an error unmarshalling the email")
+	}
+
+	presented := testPresenter().Present(ctx, err)
+
+	if code := presented.Extensions["code"]; code != CodeBadInput {
+		t.Fatalf("expected code %s, got %v", CodeBadInput, code)
+	}
+	if presented.Message != "not an email is not a valid email" {
+		t.Fatalf("expected the unmarshal error to be shown, got %q", presented.Message)
+	}
+	if path := presented.Path.String(); path != "user.email" {
+		t.Fatalf("expected the path of the argument, got %s", path)
+	}
+}
+
+func TestPresentResolverErrorIsMasked(t *testing.T) {
+	ctx := userFieldContext()
+	err := graphql.ErrorOnPath(ctx, errors.New("connection refused"))
+
+	presented := testPresenter().Present(ctx, err)
+
+	if code := presented.Extensions["code"]; code != CodeInternal {
+		t.Fatalf("expected code %s, got %v", CodeInternal, code)
+	}
+	if presented.Message != internalMessage {
+		t.Fatalf("expected the resolver error to be masked, got %q", presented.Message)
+	}
+}
+
+func testPresenter() Presenter {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return Presenter{
+		Mask:   true,
+		Logger: logrus.NewEntry(logger),
+	}
+}
@@ -0,0 +1,44 @@
+package gqlerrors
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/middleware"
+)
+
+// RequestIDExtension adds the request ID to the extensions of every error in
+// a response, including errors returned before the operation is executed
+type RequestIDExtension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+} = RequestIDExtension{}
+
+func (RequestIDExtension) ExtensionName() string {
+	return "RequestIDExtension"
+}
+
+func (RequestIDExtension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (RequestIDExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp == nil || len(resp.Errors) == 0 {
+		return resp
+	}
+
+	requestID := middleware.RequestIDFromContext(ctx)
+	if requestID == "" {
+		return resp
+	}
+
+	for _, err := range resp.Errors {
+		err.Extensions = copyExtensions(err.Extensions, 1)
+		err.Extensions["requestId"] = requestID
+	}
+
+	return resp
+}
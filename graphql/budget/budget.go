@@ -0,0 +1,138 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	ErrComplexityLimitCode  = "COMPLEXITY_LIMIT_EXCEEDED"
+	ErrComplexityBudgetCode = "COMPLEXITY_BUDGET_EXCEEDED"
+
+	// complexityStatsExtension is the name the stats are recorded under by
+	// extension.ComplexityLimit, so that extension.GetComplexityStats can be used
+	complexityStatsExtension = "ComplexityLimit"
+)
+
+// ComplexityBudget limits the complexity of operations using the allowance
+// chosen by a Policy. It replaces extension.ComplexityLimit
+type ComplexityBudget struct {
+	Policy Policy
+
+	// Store for rolling budgets, budgets are not enforced when nil
+	Store Store
+
+	// Window of the rolling budgets
+	Window time.Duration
+
+	Logger *logrus.Entry
+
+	es graphql.ExecutableSchema
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = &ComplexityBudget{}
+
+func (b *ComplexityBudget) ExtensionName() string {
+	return "ComplexityBudget"
+}
+
+func (b *ComplexityBudget) Validate(schema graphql.ExecutableSchema) error {
+	if b.Policy == nil {
+		return fmt.Errorf("ComplexityBudget policy can not be nil")
+	}
+	if b.Store != nil && b.Window <= 0 {
+		return fmt.Errorf("ComplexityBudget window must be positive")
+	}
+	b.es = schema
+	return nil
+}
+
+func (b *ComplexityBudget) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	cost := complexity.Calculate(b.es, op, rc.Variables)
+
+	allowance := b.Policy.Allowance(ctx, rc)
+
+	rc.Stats.SetExtension(complexityStatsExtension, &extension.ComplexityStats{
+		Complexity:      cost,
+		ComplexityLimit: allowance.Limit,
+	})
+
+	if allowance.Limit > 0 && cost > allowance.Limit {
+		return b.reject(ctx, rc, allowance, ErrComplexityLimitCode,
+			fmt.Sprintf("operation has complexity %d, which exceeds the limit of %d", cost, allowance.Limit))
+	}
+
+	if b.Store == nil || allowance.Budget <= 0 || cost == 0 {
+		return nil
+	}
+
+	// budgets fail open, so that an unavailable store doesn't stop every operation
+	spent, err := b.Store.Spent(ctx, allowance.Key, b.Window)
+	if err != nil {
+		b.logger(ctx).WithError(err).Error("could not read complexity budget")
+		return nil
+	}
+
+	// concurrent operations may exceed the budget slightly, as the budget is
+	// not reserved before it is spent
+	if spent+cost > allowance.Budget {
+		return b.reject(ctx, rc, allowance, ErrComplexityBudgetCode,
+			fmt.Sprintf("operation has complexity %d, which exceeds the remaining budget of %d per %s",
+				cost, max(allowance.Budget-spent, 0), b.Window))
+	}
+
+	if err := b.Store.Spend(ctx, allowance.Key, cost, b.Window); err != nil {
+		b.logger(ctx).WithError(err).Error("could not spend complexity budget")
+	}
+
+	return nil
+}
+
+func (b *ComplexityBudget) reject(ctx context.Context, rc *graphql.OperationContext, allowance Allowance, code, message string) *gqlerror.Error {
+	opName := rc.OperationName
+	if opName == "" && rc.Operation != nil {
+		opName = rc.Operation.Name
+	}
+
+	b.logger(ctx).WithFields(logrus.Fields{
+		"operation": opName,
+		"code":      code,
+		"principal": allowance.Key,
+	}).Warn(message)
+
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
+
+func (b *ComplexityBudget) logger(ctx context.Context) *logrus.Entry {
+	if logger := middleware.LogrusFromContext(ctx); logger != nil {
+		return logger
+	}
+	if b.Logger != nil {
+		return b.Logger
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package budget
+
+import "time"
+
+type Config struct {
+	// Complexity limit for unauthenticated operations, 0 uses the default limit
+	AnonymousLimit int `env:"COMPLEXITY_LIMIT_ANONYMOUS"`
+
+	// Complexity limit for authenticated operations without a tier, 0 uses the default limit
+	AuthenticatedLimit int `env:"COMPLEXITY_LIMIT_AUTHENTICATED"`
+
+	// Claim holding the tier of authenticated users, e.g. a Firebase custom claim "tier"
+	TierClaim string `env:"COMPLEXITY_TIER_CLAIM"`
+
+	// Complexity limits by tier or API key plan, e.g. "free:200,pro:1000"
+	TierLimits map[string]int `env:"COMPLEXITY_TIER_LIMITS"`
+
+	// Header holding an API key, which takes precedence over the authenticated user
+	APIKeyHeader string `env:"COMPLEXITY_API_KEY_HEADER"`
+
+	// Plans of API keys, e.g. "key1:free,key2:pro"
+	APIKeyPlans map[string]string `env:"COMPLEXITY_API_KEY_PLANS" secret:"true"`
+
+	// Window of the rolling complexity budget, 0 disables budgets
+	BudgetWindow time.Duration `env:"COMPLEXITY_BUDGET_WINDOW"`
+
+	// Total complexity allowed per window for each unauthenticated client, 0 means no budget
+	AnonymousBudget int `env:"COMPLEXITY_BUDGET_ANONYMOUS"`
+
+	// Total complexity allowed per window for each authenticated user without a tier,
+	// 0 means no budget
+	AuthenticatedBudget int `env:"COMPLEXITY_BUDGET_AUTHENTICATED"`
+
+	// Total complexity allowed per window by tier or API key plan, e.g. "free:5000,pro:50000"
+	TierBudgets map[string]int `env:"COMPLEXITY_TIER_BUDGETS"`
+
+	// Store for budgets, one of "memory" or "redis"
+	BudgetBackend string `env:"COMPLEXITY_BUDGET_BACKEND"`
+}
+
+// Enabled reports whether limits other than the default limit, or budgets, are set
+func (c Config) Enabled() bool {
+	return c.AnonymousLimit > 0 ||
+		c.AuthenticatedLimit > 0 ||
+		len(c.TierLimits) > 0 ||
+		c.BudgetWindow > 0
+}
@@ -0,0 +1,114 @@
+package budget
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/middleware"
+)
+
+// Allowance is the complexity an operation may use
+type Allowance struct {
+	// Key identifies the principal whose budget is spent
+	Key string
+
+	// Limit on the complexity of a single operation, 0 means no limit
+	Limit int
+
+	// Total complexity allowed per window, 0 means no budget
+	Budget int
+}
+
+// Policy chooses the allowance for an operation from the request context
+type Policy interface {
+	Allowance(ctx context.Context, rc *graphql.OperationContext) Allowance
+}
+
+// PolicyFunc adapts a function to a Policy
+type PolicyFunc func(ctx context.Context, rc *graphql.OperationContext) Allowance
+
+func (f PolicyFunc) Allowance(ctx context.Context, rc *graphql.OperationContext) Allowance {
+	return f(ctx, rc)
+}
+
+// TierPolicy chooses the allowance by API key plan, then by the tier claim of
+// the authenticated user, then by whether the user is authenticated
+type TierPolicy struct {
+	Config Config
+
+	// DefaultLimit applies when no other limit is configured
+	DefaultLimit int
+}
+
+func (p TierPolicy) Allowance(ctx context.Context, rc *graphql.OperationContext) Allowance {
+	if p.Config.APIKeyHeader != "" && rc.Headers != nil {
+		if key := rc.Headers.Get(p.Config.APIKeyHeader); key != "" {
+			if plan, ok := p.Config.APIKeyPlans[key]; ok {
+				return p.tier(plan, "apikey:"+hashKey(key), p.Config.AuthenticatedLimit, p.Config.AuthenticatedBudget)
+			}
+		}
+	}
+
+	if principal := auth.PrincipalFromContext(ctx); principal != nil {
+		key := fmt.Sprintf("user:%s:%s", principal.Provider, principal.Subject)
+
+		if p.Config.TierClaim != "" {
+			if tier, ok := principal.Claims[p.Config.TierClaim].(string); ok {
+				return p.tier(tier, key, p.Config.AuthenticatedLimit, p.Config.AuthenticatedBudget)
+			}
+		}
+
+		return Allowance{
+			Key:    key,
+			Limit:  p.limit(p.Config.AuthenticatedLimit),
+			Budget: p.Config.AuthenticatedBudget,
+		}
+	}
+
+	return Allowance{
+		Key:    "anonymous:" + clientIP(ctx),
+		Limit:  p.limit(p.Config.AnonymousLimit),
+		Budget: p.Config.AnonymousBudget,
+	}
+}
+
+// tier returns the allowance of a tier, falling back to limit and budget for
+// tiers which are not configured
+func (p TierPolicy) tier(tier, key string, limit, budget int) Allowance {
+	if tierLimit, ok := p.Config.TierLimits[tier]; ok {
+		limit = tierLimit
+	}
+	if tierBudget, ok := p.Config.TierBudgets[tier]; ok {
+		budget = tierBudget
+	}
+
+	return Allowance{
+		Key:    key,
+		Limit:  p.limit(limit),
+		Budget: budget,
+	}
+}
+
+func (p TierPolicy) limit(limit int) int {
+	if limit > 0 {
+		return limit
+	}
+	return p.DefaultLimit
+}
+
+func clientIP(ctx context.Context) string {
+	if c := middleware.GinContextFromContext(ctx); c != nil {
+		return c.ClientIP()
+	}
+	return "unknown"
+}
+
+// hashKey avoids storing API keys in budget keys
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
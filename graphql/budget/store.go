@@ -0,0 +1,161 @@
+package budget
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Store records the complexity spent by each principal.
+//
+// Budgets roll over a sliding window, approximated from the spend in the
+// current and previous fixed windows
+type Store interface {
+	// Spent returns the complexity spent by key in the last window
+	Spent(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// Spend adds cost to the complexity spent by key
+	Spend(ctx context.Context, key string, cost int, window time.Duration) error
+}
+
+// slidingSpend weights the previous window by how much of it is still within
+// the sliding window
+func slidingSpend(now time.Time, window time.Duration, current, previous int) int {
+	elapsed := float64(now.UnixNano()%int64(window)) / float64(window)
+	return current + int(float64(previous)*(1-elapsed))
+}
+
+func windowIndex(now time.Time, window time.Duration) int64 {
+	return now.UnixNano() / int64(window)
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep int64
+}
+
+type memoryEntry struct {
+	index    int64
+	current  int
+	previous int
+}
+
+// NewMemoryStore creates a store local to this server
+func NewMemoryStore() Store {
+	return &memoryStore{entries: map[string]*memoryEntry{}}
+}
+
+func (s *memoryStore) Spent(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entry(key, windowIndex(now, window))
+	return slidingSpend(now, window, entry.current, entry.previous), nil
+}
+
+func (s *memoryStore) Spend(ctx context.Context, key string, cost int, window time.Duration) error {
+	index := windowIndex(time.Now(), window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entry(key, index).current += cost
+	s.sweep(index)
+	return nil
+}
+
+// entry returns the entry for key, rolled over to the window index
+func (s *memoryStore) entry(key string, index int64) *memoryEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{index: index}
+		s.entries[key] = entry
+	}
+
+	switch {
+	case entry.index == index-1:
+		entry.previous, entry.current = entry.current, 0
+	case entry.index < index-1:
+		entry.previous, entry.current = 0, 0
+	}
+	entry.index = index
+
+	return entry
+}
+
+// sweep removes entries with nothing spent in the current or previous window,
+// at most once per window
+func (s *memoryStore) sweep(index int64) {
+	if s.lastSweep == index {
+		return
+	}
+	s.lastSweep = index
+
+	for key, entry := range s.entries {
+		if entry.index < index-1 {
+			delete(s.entries, key)
+		}
+	}
+}
+
+type redisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a store shared by every server using the same Redis and prefix
+func NewRedisStore(client redis.UniversalClient, prefix string) Store {
+	return &redisStore{
+		client: client,
+		prefix: "budget:" + prefix + ":",
+	}
+}
+
+func (s *redisStore) Spent(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+	index := windowIndex(now, window)
+
+	values, err := s.client.MGet(ctx, s.key(key, index), s.key(key, index-1)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return slidingSpend(now, window, parseSpend(values[0]), parseSpend(values[1])), nil
+}
+
+func (s *redisStore) Spend(ctx context.Context, key string, cost int, window time.Duration) error {
+	k := s.key(key, windowIndex(time.Now(), window))
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, k, int64(cost))
+		// kept while it is the current or previous window
+		pipe.Expire(ctx, k, 2*window)
+		return nil
+	})
+	return err
+}
+
+// key hash tags the principal so that its windows are in the same cluster slot
+func (s *redisStore) key(key string, index int64) string {
+	return s.prefix + "{" + key + "}:" + strconv.FormatInt(index, 10)
+}
+
+func parseSpend(value interface{}) int {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	spend, _ := strconv.Atoi(s)
+	return spend
+}
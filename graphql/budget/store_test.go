@@ -0,0 +1,33 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedisStoreKeysShareHashTag(t *testing.T) {
+	s := NewRedisStore(nil, "app").(*redisStore)
+
+	current := s.key("uid:123", 10)
+	previous := s.key("uid:123", 9)
+
+	if current != "budget:app:{uid:123}:10" {
+		t.Fatalf("unexpected key %q", current)
+	}
+	if hashTag(current) != hashTag(previous) {
+		t.Fatalf("keys %q and %q hash to different cluster slots", current, previous)
+	}
+}
+
+// hashTag returns the part of key Redis Cluster hashes to choose a slot
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
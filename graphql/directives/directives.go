@@ -0,0 +1,170 @@
+package directives
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/gqlerrors"
+)
+
+// Schema declares the directives implemented by this package.
+// Add it to the schema sources used by gqlgen to generate a DirectiveRoot.
+const Schema = `
+directive @authenticated on FIELD_DEFINITION | OBJECT
+directive @hasRole(roles: [String!]!) on FIELD_DEFINITION | OBJECT
+directive @hasClaim(key: String!, value: String) on FIELD_DEFINITION | OBJECT
+`
+
+const (
+	// CodeUnauthenticated is the extension code of errors returned when there
+	// is no authenticated user
+	CodeUnauthenticated = gqlerrors.CodeUnauthenticated
+
+	// CodeForbidden is the extension code of errors returned when the
+	// authenticated user lacks a required role or claim
+	CodeForbidden = gqlerrors.CodeForbidden
+)
+
+type Config struct {
+	// Custom claim holding the user's roles, as a string or list of strings
+	RolesClaim string
+}
+
+var DefaultConfig = Config{
+	RolesClaim: "roles",
+}
+
+// Directives implements @authenticated, @hasRole and @hasClaim using the
+// claims of the Principal authenticated by the auth package
+type Directives struct {
+	Config Config
+}
+
+func New(cfg Config) Directives {
+	return Directives{
+		Config: cfg,
+	}
+}
+
+// Authenticated allows access to any authenticated user
+func (d Directives) Authenticated(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if auth.PrincipalFromContext(ctx) == nil {
+		return nil, unauthenticated(ctx)
+	}
+	return next(ctx)
+}
+
+// HasRole allows access to authenticated users with at least one of roles
+func (d Directives) HasRole(ctx context.Context, obj interface{}, next graphql.Resolver, roles []string) (interface{}, error) {
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, unauthenticated(ctx)
+	}
+
+	userRoles := claimValues(principal.Claims[d.Config.RolesClaim])
+	for _, role := range roles {
+		if contains(userRoles, role) {
+			return next(ctx)
+		}
+	}
+
+	return nil, forbidden(ctx, "missing required role")
+}
+
+// HasClaim allows access to authenticated users with the claim key. When value
+// is provided the claim must equal, or contain, value. Otherwise the claim must
+// be present and not false.
+func (d Directives) HasClaim(ctx context.Context, obj interface{}, next graphql.Resolver, key string, value *string) (interface{}, error) {
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, unauthenticated(ctx)
+	}
+
+	claim, ok := principal.Claims[key]
+	if !ok || claim == nil || claim == false {
+		return nil, forbidden(ctx, "missing required claim")
+	}
+
+	if value != nil && !contains(claimValues(claim), *value) {
+		return nil, forbidden(ctx, "missing required claim")
+	}
+
+	return next(ctx)
+}
+
+// Wire assigns the directive implementations to the matching fields of a
+// generated DirectiveRoot. root must be a pointer to the DirectiveRoot.
+// Fields for directives missing from the schema are ignored.
+func (d Directives) Wire(root interface{}) error {
+	v := reflect.ValueOf(root)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("directives: expected pointer to DirectiveRoot, got %T", root)
+	}
+	v = v.Elem()
+
+	implementations := map[string]interface{}{
+		"Authenticated": d.Authenticated,
+		"HasRole":       d.HasRole,
+		"HasClaim":      d.HasClaim,
+	}
+
+	for name, implementation := range implementations {
+		field := v.FieldByName(name)
+		if !field.IsValid() {
+			continue
+		}
+
+		impl := reflect.ValueOf(implementation)
+		if !impl.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("directives: DirectiveRoot.%s has type %s, expected %s. Is the schema using directives.Schema?", name, field.Type(), impl.Type())
+		}
+		field.Set(impl)
+	}
+
+	return nil
+}
+
+// Wire assigns the directive implementations using DefaultConfig
+func Wire(root interface{}) error {
+	return New(DefaultConfig).Wire(root)
+}
+
+func unauthenticated(ctx context.Context) error {
+	return graphql.ErrorOnPath(ctx, gqlerrors.Unauthenticated("not authenticated"))
+}
+
+func forbidden(ctx context.Context, message string) error {
+	return graphql.ErrorOnPath(ctx, gqlerrors.Forbidden(message))
+}
+
+// claimValues converts a claim into a list of strings
+func claimValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			values = append(values, fmt.Sprint(value))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
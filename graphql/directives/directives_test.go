@@ -0,0 +1,85 @@
+package directives
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/gqlerrors"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		code      string
+	}{
+		{
+			name: "unauthenticated",
+			code: CodeUnauthenticated,
+		},
+		{
+			name:      "missing role",
+			principal: &auth.Principal{Claims: map[string]interface{}{"roles": []interface{}{"viewer"}}},
+			code:      CodeForbidden,
+		},
+		{
+			name:      "no roles claim",
+			principal: &auth.Principal{Claims: map[string]interface{}{}},
+			code:      CodeForbidden,
+		},
+		{
+			name:      "allowed role",
+			principal: &auth.Principal{Claims: map[string]interface{}{"roles": []interface{}{"viewer", "admin"}}},
+		},
+		{
+			name:      "allowed role as string",
+			principal: &auth.Principal{Claims: map[string]interface{}{"roles": "editor"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := fieldContext()
+			if tt.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tt.principal)
+			}
+
+			called := false
+			next := func(ctx context.Context) (interface{}, error) {
+				called = true
+				return "resolved", nil
+			}
+
+			res, err := New(DefaultConfig).HasRole(ctx, nil, next, []string{"admin", "editor"})
+
+			if tt.code == "" {
+				if err != nil || !called || res != "resolved" {
+					t.Fatalf("expected the field to resolve, got %v, %v", res, err)
+				}
+				return
+			}
+
+			if called {
+				t.Fatal("expected the resolver not to be called")
+			}
+			var gqlErr *gqlerrors.Error
+			if !errors.As(err, &gqlErr) || gqlErr.Code != tt.code {
+				t.Fatalf("expected code %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+// fieldContext returns the context of a field being resolved
+func fieldContext() context.Context {
+	return graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+		Object: "Query",
+		Field: graphql.CollectedField{
+			Field: &ast.Field{Alias: "users", Name: "users"},
+		},
+	})
+}
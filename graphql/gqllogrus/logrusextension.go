@@ -16,6 +16,7 @@ type LogrusExtension struct {
 
 var _ interface {
 	graphql.HandlerExtension
+	graphql.OperationInterceptor
 	graphql.FieldInterceptor
 } = LogrusExtension{}
 
@@ -26,6 +27,24 @@ func (n LogrusExtension) ExtensionName() string {
 func (n LogrusExtension) Validate(schema graphql.ExecutableSchema) error {
 	return nil
 }
+
+// InterceptOperation records the operation for the access log
+func (n LogrusExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+
+	opName := oc.OperationName
+	opType := ""
+	if oc.Operation != nil {
+		if opName == "" {
+			opName = oc.Operation.Name
+		}
+		opType = string(oc.Operation.Operation)
+	}
+	middleware.RequestInfoFromContext(ctx).SetOperation(opName, opType)
+
+	return next(ctx)
+}
+
 func (n LogrusExtension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
 	logger := middleware.LogrusFromContext(ctx)
 	oc := graphql.GetOperationContext(ctx)
@@ -0,0 +1,133 @@
+package gqllogrus
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// SlogHandler is a slog.Handler writing to the logrus logger of the request
+// in the context, so records have the same fields as other logs of the
+// request. Groups are flattened into field names joined by "."
+type SlogHandler struct {
+	// Logger is used when there is no logger in the context
+	Logger *logrus.Entry
+
+	fields logrus.Fields
+	group  string
+}
+
+var _ slog.Handler = &SlogHandler{}
+
+// NewSlogHandler creates a slog.Handler falling back to logger
+func NewSlogHandler(logger *logrus.Entry) *SlogHandler {
+	return &SlogHandler{
+		Logger: logger,
+	}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	logger := h.logger(ctx)
+	return logger != nil && logger.Logger.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	logger := h.logger(ctx)
+	if logger == nil {
+		return nil
+	}
+
+	fields := make(logrus.Fields, len(h.fields)+record.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(fields, h.group, attr)
+		return true
+	})
+
+	entry := logger.WithFields(fields)
+	if !record.Time.IsZero() {
+		entry = entry.WithTime(record.Time)
+	}
+	entry.Log(logrusLevel(record.Level), record.Message)
+
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, attr := range attrs {
+		addAttr(fields, h.group, attr)
+	}
+
+	return &SlogHandler{
+		Logger: h.Logger,
+		fields: fields,
+		group:  h.group,
+	}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &SlogHandler{
+		Logger: h.Logger,
+		fields: h.fields,
+		group:  h.group + name + ".",
+	}
+}
+
+func (h *SlogHandler) logger(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if logger := From(ctx); logger != nil {
+			return logger
+		}
+		if logger := middleware.LogrusFromContext(ctx); logger != nil {
+			return logger
+		}
+	}
+	return h.Logger
+}
+
+func addAttr(fields logrus.Fields, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+		// groups with an empty key are inlined
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			addAttr(fields, prefix, groupAttr)
+		}
+		return
+	}
+
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
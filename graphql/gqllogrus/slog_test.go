@@ -0,0 +1,88 @@
+package gqllogrus
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSlogHandlerFields(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	log := slog.New(NewSlogHandler(logrus.NewEntry(logger)))
+
+	log.With("service", "users").
+		WithGroup("request").
+		Warn("slow request", "path", "/graphql", slog.Group("auth", "uid", "123"), slog.Group("", "inlined", true))
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("expected an entry to be logged")
+	}
+	if entry.Level != logrus.WarnLevel || entry.Message != "slow request" {
+		t.Fatalf("expected a warning \"slow request\", got %s %q", entry.Level, entry.Message)
+	}
+
+	expected := logrus.Fields{
+		"service":          "users",
+		"request.path":     "/graphql",
+		"request.auth.uid": "123",
+		"request.inlined":  true,
+	}
+	if len(entry.Data) != len(expected) {
+		t.Fatalf("expected fields %v, got %v", expected, entry.Data)
+	}
+	for k, v := range expected {
+		if entry.Data[k] != v {
+			t.Fatalf("expected field %s to be %v, got %v", k, v, entry.Data[k])
+		}
+	}
+}
+
+func TestSlogHandlerLevels(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.InfoLevel)
+	log := slog.New(NewSlogHandler(logrus.NewEntry(logger)))
+
+	log.Debug("hidden")
+	if len(hook.AllEntries()) != 0 {
+		t.Fatal("expected debug records to be disabled at info level")
+	}
+
+	tests := []struct {
+		level    slog.Level
+		expected logrus.Level
+	}{
+		{slog.LevelInfo, logrus.InfoLevel},
+		{slog.LevelWarn, logrus.WarnLevel},
+		{slog.LevelError, logrus.ErrorLevel},
+		{slog.LevelError + 4, logrus.ErrorLevel},
+	}
+	for _, tt := range tests {
+		log.Log(context.Background(), tt.level, "message")
+		if level := hook.LastEntry().Level; level != tt.expected {
+			t.Fatalf("expected slog level %s to log at %s, got %s", tt.level, tt.expected, level)
+		}
+	}
+}
+
+func TestSlogHandlerUsesContextLogger(t *testing.T) {
+	fallback, fallbackHook := test.NewNullLogger()
+	requestLogger, requestHook := test.NewNullLogger()
+
+	log := slog.New(NewSlogHandler(logrus.NewEntry(fallback)))
+	ctx := new(context.Background(), requestLogger.WithField("request.id", "abc"))
+
+	log.InfoContext(ctx, "in request")
+	log.Info("outside request")
+
+	entry := requestHook.LastEntry()
+	if entry == nil || entry.Message != "in request" || entry.Data["request.id"] != "abc" {
+		t.Fatalf("expected the record to be logged by the request logger, got %v", entry)
+	}
+	if entry := fallbackHook.LastEntry(); entry == nil || entry.Message != "outside request" {
+		t.Fatalf("expected records without a request logger to use the fallback, got %v", entry)
+	}
+}
@@ -0,0 +1,258 @@
+package gqllogrus
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/maxtroughear/gqlserver/redact"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+type SlowOperationConfig struct {
+	// Operations taking longer are logged with their query and slowest
+	// resolvers, 0 disables the slow operation log. Disabled by default
+	Threshold time.Duration `env:"SLOW_OPERATION_THRESHOLD"`
+
+	// Number of the slowest resolvers to log
+	TopResolvers int `env:"SLOW_OPERATION_TOP_RESOLVERS"`
+}
+
+type slowOperationContextKey struct{}
+
+// SlowOperationExtension logs queries and mutations which take longer than
+// the threshold, from the start of the request until the response
+type SlowOperationExtension struct {
+	Config SlowOperationConfig
+	Logger *logrus.Entry
+
+	// Redactor replaces sensitive variables, all variables are logged when nil
+	Redactor *redact.Redactor
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.FieldInterceptor
+} = SlowOperationExtension{}
+
+func (e SlowOperationExtension) ExtensionName() string {
+	return "SlowOperationExtension"
+}
+
+func (e SlowOperationExtension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// resolverTiming is the duration of a resolver
+type resolverTiming struct {
+	Path       string  `json:"path"`
+	DurationMs float64 `json:"duration_ms"`
+
+	duration time.Duration
+}
+
+// slowestResolvers keeps the slowest max resolvers of an operation
+type slowestResolvers struct {
+	mu      sync.Mutex
+	max     int
+	timings []resolverTiming
+}
+
+func (s *slowestResolvers) add(fc *graphql.FieldContext, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.timings) == s.max && duration <= s.timings[len(s.timings)-1].duration {
+		return
+	}
+
+	// the path is only formatted for resolvers which are kept
+	timing := resolverTiming{
+		Path:       fc.Path().String(),
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		duration:   duration,
+	}
+
+	i := sort.Search(len(s.timings), func(i int) bool {
+		return s.timings[i].duration < duration
+	})
+	if len(s.timings) < s.max {
+		s.timings = append(s.timings, resolverTiming{})
+	}
+	copy(s.timings[i+1:], s.timings[i:])
+	s.timings[i] = timing
+}
+
+func (e SlowOperationExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	if e.Config.Threshold <= 0 || oc.Operation == nil || oc.Operation.Operation == ast.Subscription {
+		return next(ctx)
+	}
+
+	start := oc.Stats.OperationStart
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	resolvers := &slowestResolvers{max: e.Config.TopResolvers}
+	if resolvers.max > 0 {
+		ctx = context.WithValue(ctx, slowOperationContextKey{}, resolvers)
+	}
+
+	responses := next(ctx)
+
+	return func(ctx context.Context) *graphql.Response {
+		resp := responses(ctx)
+
+		if duration := time.Since(start); duration > e.Config.Threshold {
+			e.log(ctx, oc, duration, resolvers)
+		}
+
+		return resp
+	}
+}
+
+func (e SlowOperationExtension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	resolvers, ok := ctx.Value(slowOperationContextKey{}).(*slowestResolvers)
+	if !ok {
+		return next(ctx)
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	if !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	defer func() {
+		resolvers.add(fc, time.Since(start))
+	}()
+
+	return next(ctx)
+}
+
+func (e SlowOperationExtension) log(ctx context.Context, oc *graphql.OperationContext, duration time.Duration, resolvers *slowestResolvers) {
+	logger := middleware.LogrusFromContext(ctx)
+	if logger == nil {
+		logger = e.Logger
+	}
+	if logger == nil {
+		return
+	}
+
+	opName := oc.OperationName
+	if opName == "" {
+		opName = oc.Operation.Name
+	}
+
+	fields := logrus.Fields{
+		"graphql.operation.name": opName,
+		"graphql.operation.type": string(oc.Operation.Operation),
+		"graphql.duration_ms":    float64(duration.Microseconds()) / 1000,
+		"graphql.document":       normalizeDocument(oc.RawQuery),
+	}
+
+	if stats := extension.GetComplexityStats(ctx); stats != nil {
+		fields["graphql.complexity"] = stats.Complexity
+	}
+
+	if len(oc.Variables) > 0 {
+		if e.Redactor != nil {
+			fields["graphql.variables"] = e.Redactor.Value(oc.Variables)
+		} else {
+			fields["graphql.variables"] = oc.Variables
+		}
+	}
+
+	resolvers.mu.Lock()
+	if len(resolvers.timings) > 0 {
+		fields["graphql.slowest_resolvers"] = append([]resolverTiming(nil), resolvers.timings...)
+	}
+	resolvers.mu.Unlock()
+
+	logger.WithFields(fields).Warn("slow operation")
+}
+
+// normalizeDocument formats the query on a single line with its literal
+// values hidden, as they may hold secrets such as inline passwords. The query
+// is parsed again, as the parsed document may be shared by the query cache
+func normalizeDocument(query string) string {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return ""
+	}
+
+	hideLiterals(doc)
+
+	var b strings.Builder
+	formatter.NewFormatter(&b).FormatQueryDocument(doc)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// hideLiterals replaces strings with "", numbers with 0, and lists and
+// objects with empty values. Variables, booleans and enums are kept
+func hideLiterals(doc *ast.QueryDocument) {
+	for _, op := range doc.Operations {
+		for _, variable := range op.VariableDefinitions {
+			hideValue(variable.DefaultValue)
+			hideDirectives(variable.Directives)
+		}
+		hideDirectives(op.Directives)
+		hideSelectionSet(op.SelectionSet)
+	}
+	for _, fragment := range doc.Fragments {
+		hideDirectives(fragment.Directives)
+		hideSelectionSet(fragment.SelectionSet)
+	}
+}
+
+func hideSelectionSet(set ast.SelectionSet) {
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			for _, arg := range selection.Arguments {
+				hideValue(arg.Value)
+			}
+			hideDirectives(selection.Directives)
+			hideSelectionSet(selection.SelectionSet)
+		case *ast.InlineFragment:
+			hideDirectives(selection.Directives)
+			hideSelectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			hideDirectives(selection.Directives)
+		}
+	}
+}
+
+func hideDirectives(directives ast.DirectiveList) {
+	for _, directive := range directives {
+		for _, arg := range directive.Arguments {
+			hideValue(arg.Value)
+		}
+	}
+}
+
+func hideValue(value *ast.Value) {
+	if value == nil {
+		return
+	}
+
+	switch value.Kind {
+	case ast.StringValue, ast.BlockValue:
+		value.Kind = ast.StringValue
+		value.Raw = ""
+	case ast.IntValue, ast.FloatValue:
+		value.Raw = "0"
+	case ast.ListValue, ast.ObjectValue:
+		value.Children = nil
+	}
+}
@@ -0,0 +1,27 @@
+package gqllogrus
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDocumentHidesLiterals(t *testing.T) {
+	query := `mutation Login($device: String = "laptop") {
+		login(password: "hunter2", attempts: 3, scopes: ["admin"], input: {pin: 1234}) {
+			token @include(if: true)
+		}
+	}`
+
+	normalized := normalizeDocument(query)
+
+	for _, secret := range []string{"hunter2", "laptop", "admin", "1234"} {
+		if strings.Contains(normalized, secret) {
+			t.Errorf("normalized document contains %q: %s", secret, normalized)
+		}
+	}
+	for _, placeholder := range []string{`password: ""`, "attempts: 0", "scopes: []", "input: {}", "if: true"} {
+		if !strings.Contains(normalized, placeholder) {
+			t.Errorf("normalized document is missing %q: %s", placeholder, normalized)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package limits
+
+type Config struct {
+	// Maximum depth of nested field selections, including introspection fields,
+	// 0 means no limit. Introspection queries of tools such as the playground
+	// are nested around a dozen fields deep
+	MaxDepth int `env:"QUERY_MAX_DEPTH"`
+
+	// Maximum number of aliased fields, including fields in fragments and
+	// introspection fields, 0 means no limit
+	MaxAliases int `env:"QUERY_MAX_ALIASES"`
+
+	// Maximum number of fields selected on the root type, 0 means no limit
+	MaxRootFields int `env:"QUERY_MAX_ROOT_FIELDS"`
+
+	// Maximum number of directives on a single field, 0 means no limit
+	MaxDirectivesPerField int `env:"QUERY_MAX_DIRECTIVES_PER_FIELD"`
+
+	// Maximum number of tokens in the query document, checked before parsing.
+	// 0 means no limit
+	MaxTokens int `env:"QUERY_MAX_TOKENS"`
+}
+
+// Enabled reports whether any limit is set
+func (c Config) Enabled() bool {
+	return c.MaxDepth > 0 ||
+		c.MaxAliases > 0 ||
+		c.MaxRootFields > 0 ||
+		c.MaxDirectivesPerField > 0 ||
+		c.MaxTokens > 0
+}
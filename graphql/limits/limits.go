@@ -0,0 +1,207 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/lexer"
+)
+
+const (
+	ErrDepthLimitCode     = "DEPTH_LIMIT_EXCEEDED"
+	ErrAliasLimitCode     = "ALIAS_LIMIT_EXCEEDED"
+	ErrRootFieldLimitCode = "ROOT_FIELD_LIMIT_EXCEEDED"
+	ErrDirectiveLimitCode = "DIRECTIVE_LIMIT_EXCEEDED"
+	ErrTokenLimitCode     = "TOKEN_LIMIT_EXCEEDED"
+)
+
+// Limits rejects operations exceeding limits on the shape of the query.
+// The token limit is checked before the query is parsed, the others once it
+// has been validated
+type Limits struct {
+	Config Config
+	Logger *logrus.Entry
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+	graphql.OperationContextMutator
+} = Limits{}
+
+func (l Limits) ExtensionName() string {
+	return "Limits"
+}
+
+func (l Limits) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l Limits) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if l.Config.MaxTokens <= 0 {
+		return nil
+	}
+
+	if tokens := countTokens(params.Query, l.Config.MaxTokens); tokens > l.Config.MaxTokens {
+		return l.reject(ctx, params.OperationName, ErrTokenLimitCode,
+			fmt.Sprintf("operation has more than %d tokens", l.Config.MaxTokens))
+	}
+
+	return nil
+}
+
+func (l Limits) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	if rc.Operation == nil {
+		return nil
+	}
+
+	opName := rc.OperationName
+	if opName == "" {
+		opName = rc.Operation.Name
+	}
+
+	if l.Config.MaxRootFields > 0 {
+		if fields := countRootFields(rc.Operation.SelectionSet); fields > l.Config.MaxRootFields {
+			return l.reject(ctx, opName, ErrRootFieldLimitCode,
+				fmt.Sprintf("operation has %d root fields, which exceeds the limit of %d", fields, l.Config.MaxRootFields))
+		}
+	}
+
+	s := newShapeWalker().selectionSet(rc.Operation.SelectionSet)
+
+	if l.Config.MaxDepth > 0 && s.depth > l.Config.MaxDepth {
+		return l.reject(ctx, opName, ErrDepthLimitCode,
+			fmt.Sprintf("operation has a depth of %d, which exceeds the limit of %d", s.depth, l.Config.MaxDepth))
+	}
+	if l.Config.MaxAliases > 0 && s.aliases > l.Config.MaxAliases {
+		return l.reject(ctx, opName, ErrAliasLimitCode,
+			fmt.Sprintf("operation has %d aliases, which exceeds the limit of %d", s.aliases, l.Config.MaxAliases))
+	}
+	if l.Config.MaxDirectivesPerField > 0 && s.directives > l.Config.MaxDirectivesPerField {
+		return l.reject(ctx, opName, ErrDirectiveLimitCode,
+			fmt.Sprintf("operation has a field with %d directives, which exceeds the limit of %d", s.directives, l.Config.MaxDirectivesPerField))
+	}
+
+	return nil
+}
+
+func (l Limits) reject(ctx context.Context, opName, code, message string) *gqlerror.Error {
+	logger := middleware.LogrusFromContext(ctx)
+	if logger == nil {
+		logger = l.Logger
+	}
+	if logger != nil {
+		logger.WithFields(logrus.Fields{
+			"operation": opName,
+			"code":      code,
+		}).Warn(message)
+	}
+
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
+
+// countTokens counts the tokens in query, excluding comments, stopping once
+// max has been exceeded. Lexing errors are left to be reported by the parser
+func countTokens(query string, max int) int {
+	lex := lexer.New(&ast.Source{Input: query})
+
+	count := 0
+	for count <= max {
+		token, err := lex.ReadToken()
+		if err != nil || token.Kind == lexer.EOF {
+			break
+		}
+		if token.Kind != lexer.Comment {
+			count++
+		}
+	}
+
+	return count
+}
+
+func countRootFields(set ast.SelectionSet) int {
+	count := 0
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			count++
+		case *ast.InlineFragment:
+			count += countRootFields(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				count += countRootFields(selection.Definition.SelectionSet)
+			}
+		}
+	}
+	return count
+}
+
+// shape of a selection set
+type shape struct {
+	depth      int
+	aliases    int
+	directives int
+}
+
+func (s *shape) merge(other shape) {
+	if other.depth > s.depth {
+		s.depth = other.depth
+	}
+	if other.directives > s.directives {
+		s.directives = other.directives
+	}
+	s.aliases += other.aliases
+}
+
+// shapeWalker measures selection sets, measuring each fragment once so that
+// fragments spread repeatedly can't make the walk itself expensive
+type shapeWalker struct {
+	fragments map[string]shape
+}
+
+func newShapeWalker() *shapeWalker {
+	return &shapeWalker{fragments: map[string]shape{}}
+}
+
+func (w *shapeWalker) selectionSet(set ast.SelectionSet) shape {
+	var s shape
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			// introspection fields are measured too, as they can be nested
+			// and aliased like any other field
+			child := w.selectionSet(selection.SelectionSet)
+			child.depth++
+			if selection.Alias != "" && selection.Alias != selection.Name {
+				child.aliases++
+			}
+			if len(selection.Directives) > child.directives {
+				child.directives = len(selection.Directives)
+			}
+			s.merge(child)
+		case *ast.InlineFragment:
+			s.merge(w.selectionSet(selection.SelectionSet))
+		case *ast.FragmentSpread:
+			if selection.Definition == nil {
+				continue
+			}
+			fragment, ok := w.fragments[selection.Name]
+			if !ok {
+				fragment = w.selectionSet(selection.Definition.SelectionSet)
+				w.fragments[selection.Name] = fragment
+			}
+			s.merge(fragment)
+		}
+	}
+	return s
+}
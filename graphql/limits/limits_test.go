@@ -0,0 +1,82 @@
+package limits
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var testSchema = gqlparser.MustLoadSchema(&ast.Source{Input: `type Query { hello: String }`})
+
+func TestLimitsMeasureIntrospection(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		query  string
+		code   string
+	}{
+		{
+			name:   "aliases under __schema",
+			config: Config{MaxAliases: 3},
+			query:  `{ __schema { types { a1: name a2: name a3: name a4: name } } }`,
+			code:   ErrAliasLimitCode,
+		},
+		{
+			name:   "aliased __typename",
+			config: Config{MaxAliases: 3},
+			query:  `{ a1: __typename a2: __typename a3: __typename a4: __typename }`,
+			code:   ErrAliasLimitCode,
+		},
+		{
+			name:   "nested ofType",
+			config: Config{MaxDepth: 5},
+			query:  `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`,
+			code:   ErrDepthLimitCode,
+		},
+		{
+			name:   "within limits",
+			config: Config{MaxAliases: 3, MaxDepth: 5},
+			query:  `{ __schema { types { a1: name fields { name } } } }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, errs := gqlparser.LoadQuery(testSchema, tt.query)
+			if errs != nil {
+				t.Fatal(errs)
+			}
+
+			err := testLimits(tt.config).MutateOperationContext(context.Background(), &graphql.OperationContext{
+				Doc:       doc,
+				Operation: doc.Operations[0],
+			})
+
+			var code interface{}
+			if err != nil {
+				code = err.Extensions["code"]
+			}
+			if tt.code == "" && err != nil {
+				t.Fatalf("expected the operation to be allowed, got %v", err)
+			}
+			if tt.code != "" && code != tt.code {
+				t.Fatalf("expected code %s, got %v", tt.code, code)
+			}
+		})
+	}
+}
+
+func testLimits(config Config) Limits {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return Limits{
+		Config: config,
+		Logger: logrus.NewEntry(logger),
+	}
+}
@@ -0,0 +1,6 @@
+package otelextension
+
+type Config struct {
+	// Records the query document as an attribute of operation spans
+	RecordDocument bool `env:"OPEN_TELEMETRY_RECORD_DOCUMENT"`
+}
@@ -0,0 +1,170 @@
+package otelextension
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/maxtroughear/gqlserver/graphql/otelextension"
+
+var (
+	operationNameKey = attribute.Key("graphql.operation.name")
+	operationTypeKey = attribute.Key("graphql.operation.type")
+	documentKey      = attribute.Key("graphql.document")
+	complexityKey    = attribute.Key("graphql.operation.complexity")
+	fieldNameKey     = attribute.Key("graphql.field.name")
+	fieldPathKey     = attribute.Key("graphql.field.path")
+	fieldParentKey   = attribute.Key("graphql.field.parent_type")
+	errorCountKey    = attribute.Key("graphql.errors.count")
+)
+
+type OtelExtension struct {
+	Config Config
+
+	tracer trace.Tracer
+}
+
+func NewOtelExtension(tracerProvider trace.TracerProvider, cfg Config) OtelExtension {
+	return OtelExtension{
+		Config: cfg,
+		tracer: tracerProvider.Tracer(instrumentationName),
+	}
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.FieldInterceptor
+} = OtelExtension{}
+
+func (o OtelExtension) ExtensionName() string {
+	return "OtelExtension"
+}
+
+func (o OtelExtension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation starts a span for the operation, with child spans for parsing
+// and validation recorded from the operation's timings. The span ends with the
+// first response, or once a subscription has completed.
+func (o OtelExtension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+
+	opName := oc.OperationName
+	if opName == "" && oc.Operation != nil {
+		opName = oc.Operation.Name
+	}
+	opType := ""
+	if oc.Operation != nil {
+		opType = string(oc.Operation.Operation)
+	}
+
+	attributes := []attribute.KeyValue{
+		operationNameKey.String(opName),
+		operationTypeKey.String(opType),
+	}
+	if o.Config.RecordDocument {
+		attributes = append(attributes, documentKey.String(oc.RawQuery))
+	}
+
+	startOptions := []trace.SpanStartOption{trace.WithAttributes(attributes...)}
+	if !oc.Stats.OperationStart.IsZero() {
+		startOptions = append(startOptions, trace.WithTimestamp(oc.Stats.OperationStart))
+	}
+
+	ctx, span := o.tracer.Start(ctx, buildOperationName(opType, opName), startOptions...)
+
+	o.recordTiming(ctx, "GraphQL/Parse", oc.Stats.Parsing)
+	o.recordTiming(ctx, "GraphQL/Validate", oc.Stats.Validation)
+
+	if stats := extension.GetComplexityStats(ctx); stats != nil {
+		span.SetAttributes(complexityKey.Int(stats.Complexity))
+	}
+
+	responses := next(ctx)
+
+	return func(ctx context.Context) *graphql.Response {
+		resp := responses(ctx)
+		if resp == nil {
+			span.End()
+			return nil
+		}
+
+		if len(resp.Errors) > 0 {
+			span.SetAttributes(errorCountKey.Int(len(resp.Errors)))
+			span.SetStatus(codes.Error, resp.Errors.Error())
+		}
+
+		if opType != string(ast.Subscription) {
+			span.End()
+		}
+
+		return resp
+	}
+}
+
+func (o OtelExtension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := o.tracer.Start(ctx, buildResolverName(fc.Object, fc.Field.Name), trace.WithAttributes(
+		fieldNameKey.String(fc.Field.Name),
+		fieldPathKey.String(fc.Path().String()),
+		fieldParentKey.String(fc.Object),
+	))
+	defer span.End()
+
+	// record panics before passing them on to be recovered
+	defer func() {
+		if r := recover(); r != nil {
+			span.RecordError(fmt.Errorf("panic: %v", r))
+			span.SetStatus(codes.Error, "resolver panicked")
+			panic(r)
+		}
+	}()
+
+	result, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return result, err
+}
+
+// recordTiming records a span for a phase of the operation that has already completed
+func (o OtelExtension) recordTiming(ctx context.Context, name string, timing graphql.TraceTiming) {
+	if timing.Start.IsZero() || timing.End.IsZero() {
+		return
+	}
+
+	_, span := o.tracer.Start(ctx, name, trace.WithTimestamp(timing.Start))
+	span.End(trace.WithTimestamp(timing.End))
+}
+
+func buildOperationName(operationType, operationName string) string {
+	if operationName == "" {
+		operationName = "UNKNOWN"
+	}
+	if operationType == "" {
+		return fmt.Sprintf("GraphQL/Operation/%s", operationName)
+	}
+	return fmt.Sprintf("GraphQL/Operation/%s %s", operationType, operationName)
+}
+
+func buildResolverName(objectName, fieldName string) string {
+	if fieldName == "" {
+		fieldName = "UNKNOWN"
+	}
+	return fmt.Sprintf("GraphQL/Resolver/%s.%s", objectName, fieldName)
+}
@@ -0,0 +1,42 @@
+package promextension
+
+import (
+	"github.com/maxtroughear/gqlserver/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TieredCacheCollector exports the hit and miss counts of a tiered cache
+type TieredCacheCollector struct {
+	name  string
+	cache *cache.Tiered
+	desc  *prometheus.Desc
+}
+
+// NewTieredCacheCollector creates a collector for c, labelled with name
+func NewTieredCacheCollector(name string, c *cache.Tiered) *TieredCacheCollector {
+	return &TieredCacheCollector{
+		name:  name,
+		cache: c,
+		desc: prometheus.NewDesc(
+			"graphql_cache_requests_total",
+			"Number of cache lookups, by tier (local or remote) and result (hit or miss).",
+			[]string{"tier", "result"},
+			prometheus.Labels{"cache": name},
+		),
+	}
+}
+
+var _ prometheus.Collector = &TieredCacheCollector{}
+
+func (c *TieredCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *TieredCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(stats.LocalHits), "local", "hit")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(stats.LocalMisses), "local", "miss")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(stats.RemoteHits), "remote", "hit")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(stats.RemoteMisses), "remote", "miss")
+}
@@ -0,0 +1,11 @@
+package promextension
+
+type Config struct {
+	// Maximum number of distinct operation names recorded, taken by valid
+	// operations in the order they are first seen. Further operations, and
+	// invalid operations with other names, are recorded as "other". 0 means no limit
+	MaxOperationNames int `env:"METRICS_MAX_OPERATION_NAMES"`
+
+	// Records the duration of each resolver
+	ResolverDurations bool `env:"METRICS_RESOLVER_DURATIONS"`
+}
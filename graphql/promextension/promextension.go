@@ -0,0 +1,241 @@
+package promextension
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	extensionName = "PromExtension"
+
+	anonymousOperation = "anonymous"
+	otherOperation     = "other"
+	unknownOperation   = "unknown"
+
+	errPersistedQueryNotFoundCode = "PERSISTED_QUERY_NOT_FOUND"
+)
+
+type PromExtension struct {
+	Config Config
+
+	metrics        *metrics
+	operationNames *operationNames
+}
+
+type metrics struct {
+	operations         *prometheus.CounterVec
+	operationDuration  *prometheus.HistogramVec
+	operationErrors    *prometheus.CounterVec
+	resolverDuration   *prometheus.HistogramVec
+	complexity         *prometheus.HistogramVec
+	persistedQueries   *prometheus.CounterVec
+	subscriptionEvents *prometheus.CounterVec
+}
+
+// operationNames bounds the cardinality of the operation label by only
+// recording the first max distinct operation names
+type operationNames struct {
+	mu    sync.Mutex
+	max   int
+	names map[string]struct{}
+}
+
+// NewPromExtension creates the extension and registers its collectors with registerer
+func NewPromExtension(registerer prometheus.Registerer, cfg Config) PromExtension {
+	m := &metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "graphql",
+			Name:      "operations_total",
+			Help:      "Number of GraphQL operations handled.",
+		}, []string{"operation", "type", "status"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "graphql",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of GraphQL queries and mutations, from the start of the request until the response.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "type"}),
+		operationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "graphql",
+			Name:      "errors_total",
+			Help:      "Number of errors returned in GraphQL responses.",
+		}, []string{"operation", "type"}),
+		resolverDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "graphql",
+			Name:      "resolver_duration_seconds",
+			Help:      "Duration of GraphQL resolvers.",
+			Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"field"}),
+		complexity: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "graphql",
+			Name:      "operation_complexity",
+			Help:      "Calculated complexity of GraphQL operations.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"operation", "type"}),
+		persistedQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "graphql",
+			Name:      "apq_requests_total",
+			Help:      "Number of automatic persisted query lookups, by result (hit, miss or register).",
+		}, []string{"result"}),
+		subscriptionEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "graphql",
+			Name:      "subscription_events_total",
+			Help:      "Number of events sent to GraphQL subscriptions.",
+		}, []string{"operation"}),
+	}
+
+	registerer.MustRegister(
+		m.operations,
+		m.operationDuration,
+		m.operationErrors,
+		m.resolverDuration,
+		m.complexity,
+		m.persistedQueries,
+		m.subscriptionEvents,
+	)
+
+	return PromExtension{
+		Config:  cfg,
+		metrics: m,
+		operationNames: &operationNames{
+			max:   cfg.MaxOperationNames,
+			names: map[string]struct{}{},
+		},
+	}
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.FieldInterceptor
+	graphql.ResponseInterceptor
+} = PromExtension{}
+
+func (e PromExtension) ExtensionName() string {
+	return extensionName
+}
+
+func (e PromExtension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e PromExtension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if !e.Config.ResolverDurations || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	defer func() {
+		e.metrics.resolverDuration.
+			WithLabelValues(fc.Object + "." + fc.Field.Name).
+			Observe(time.Since(start).Seconds())
+	}()
+
+	return next(ctx)
+}
+
+func (e PromExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp == nil || !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+
+	rc := graphql.GetOperationContext(ctx)
+	opName := e.operationNames.label(operationName(rc), validated(rc))
+	opType := operationType(rc)
+
+	// subscriptions produce a response for every event, only the first is
+	// recorded as the operation
+	if rc.Stats.GetExtension(extensionName) != nil {
+		e.metrics.subscriptionEvents.WithLabelValues(opName).Inc()
+		return resp
+	}
+	rc.Stats.SetExtension(extensionName, true)
+
+	status := "success"
+	if len(resp.Errors) > 0 {
+		status = "error"
+		e.metrics.operationErrors.WithLabelValues(opName, opType).Add(float64(len(resp.Errors)))
+	}
+	e.metrics.operations.WithLabelValues(opName, opType, status).Inc()
+
+	if opType == string(ast.Subscription) {
+		e.metrics.subscriptionEvents.WithLabelValues(opName).Inc()
+	} else if !rc.Stats.OperationStart.IsZero() {
+		e.metrics.operationDuration.
+			WithLabelValues(opName, opType).
+			Observe(time.Since(rc.Stats.OperationStart).Seconds())
+	}
+
+	if stats := extension.GetComplexityStats(ctx); stats != nil {
+		e.metrics.complexity.WithLabelValues(opName, opType).Observe(float64(stats.Complexity))
+	}
+
+	if stats := extension.GetApqStats(ctx); stats != nil {
+		if stats.SentQuery {
+			e.metrics.persistedQueries.WithLabelValues("register").Inc()
+		} else {
+			e.metrics.persistedQueries.WithLabelValues("hit").Inc()
+		}
+	} else if persistedQueryNotFound(resp) {
+		e.metrics.persistedQueries.WithLabelValues("miss").Inc()
+	}
+
+	return resp
+}
+
+// label returns the operation name to record, limiting the number of distinct
+// names. Only the names of valid operations are added, so that requests which
+// fail to parse or validate can't use up the limit with made up names
+func (o *operationNames) label(name string, valid bool) string {
+	if name == "" {
+		return anonymousOperation
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.names[name]; ok {
+		return name
+	}
+	if !valid || o.max > 0 && len(o.names) >= o.max {
+		return otherOperation
+	}
+
+	o.names[name] = struct{}{}
+	return name
+}
+
+func operationName(rc *graphql.OperationContext) string {
+	if rc.OperationName == "" && rc.Operation != nil {
+		return rc.Operation.Name
+	}
+	return rc.OperationName
+}
+
+// validated reports whether the operation was found in a valid document and
+// its variables were valid
+func validated(rc *graphql.OperationContext) bool {
+	return rc.Operation != nil && !rc.Stats.Validation.End.IsZero()
+}
+
+func operationType(rc *graphql.OperationContext) string {
+	if rc.Operation == nil {
+		return unknownOperation
+	}
+	return string(rc.Operation.Operation)
+}
+
+func persistedQueryNotFound(resp *graphql.Response) bool {
+	for _, err := range resp.Errors {
+		if code, ok := err.Extensions["code"]; ok && code == errPersistedQueryNotFoundCode {
+			return true
+		}
+	}
+	return false
+}
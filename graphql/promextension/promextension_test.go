@@ -0,0 +1,75 @@
+package promextension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestInvalidOperationsDoNotUseOperationNames(t *testing.T) {
+	ext := NewPromExtension(prometheus.NewRegistry(), Config{MaxOperationNames: 2})
+
+	srv := handler.New(testSchema{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(ext)
+
+	for i := 0; i < 10; i++ {
+		// fails to parse
+		post(t, srv, fmt.Sprintf(`{"operationName": "Parse%d", "query": "query Parse%d {"}`, i, i))
+		// fails to validate
+		post(t, srv, fmt.Sprintf(`{"operationName": "Validate%d", "query": "query Validate%d { missing }"}`, i, i))
+	}
+
+	post(t, srv, `{"operationName": "First", "query": "query First { hello }"}`)
+	post(t, srv, `{"operationName": "Second", "query": "query Second { hello }"}`)
+	post(t, srv, `{"operationName": "Third", "query": "query Third { hello }"}`)
+
+	for _, name := range []string{"First", "Second"} {
+		if n := testutil.ToFloat64(ext.metrics.operations.WithLabelValues(name, "query", "success")); n != 1 {
+			t.Fatalf("expected %s to be recorded by name, got %v", name, n)
+		}
+	}
+	if n := testutil.ToFloat64(ext.metrics.operations.WithLabelValues(otherOperation, "query", "success")); n != 1 {
+		t.Fatalf("expected the third name to be recorded as %s, got %v", otherOperation, n)
+	}
+	if n := testutil.ToFloat64(ext.metrics.operations.WithLabelValues(otherOperation, unknownOperation, "error")); n != 20 {
+		t.Fatalf("expected invalid operations to be recorded as %s, got %v", otherOperation, n)
+	}
+}
+
+func post(t *testing.T, srv http.Handler, body string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+var testSchemaAST = gqlparser.MustLoadSchema(&ast.Source{Input: `type Query { hello: String }`})
+
+type testSchema struct{}
+
+func (testSchema) Schema() *ast.Schema {
+	return testSchemaAST
+}
+
+func (testSchema) Complexity(typeName, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
+	return 0, false
+}
+
+func (testSchema) Exec(ctx context.Context) graphql.ResponseHandler {
+	return func(ctx context.Context) *graphql.Response {
+		return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+	}
+}
@@ -0,0 +1,26 @@
+package safelist
+
+import "time"
+
+const (
+	// ModeOff executes any operation
+	ModeOff = "off"
+	// ModeLog executes any operation, logging operations missing from the manifest
+	ModeLog = "log"
+	// ModeEnforce only executes operations in the manifest
+	ModeEnforce = "enforce"
+)
+
+type Config struct {
+	// One of "off", "log" or "enforce"
+	Mode string `env:"SAFELIST_MODE"`
+
+	// Path to a manifest file, or a directory of manifest files
+	ManifestPath string `env:"SAFELIST_MANIFEST_PATH"`
+
+	// Redis key holding the manifest, used when ManifestPath is not set
+	ManifestRedisKey string `env:"SAFELIST_MANIFEST_REDIS_KEY"`
+
+	// Interval to reload the manifest at, 0 disables reloading
+	ReloadInterval time.Duration `env:"SAFELIST_RELOAD_INTERVAL"`
+}
@@ -0,0 +1,178 @@
+package safelist
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const apolloManifestFormat = "apollo-persisted-query-manifest"
+
+// Manifest holds the approved operations, keyed by their ID
+type Manifest struct {
+	documents map[string]string
+	// hashes holds the SHA-256 hash of every document, so that approved
+	// operations may also be sent as free-form queries
+	hashes map[string]struct{}
+}
+
+// apolloManifest is the format generated by @apollo/generate-persisted-query-manifest
+type apolloManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// Source loads the manifest of approved operations
+type Source interface {
+	Load(ctx context.Context) (*Manifest, error)
+}
+
+type fileSource struct {
+	path string
+}
+
+// FileSource loads a manifest from a file, or from every .json file in a directory
+func FileSource(path string) Source {
+	return fileSource{path: path}
+}
+
+func (s fileSource) Load(ctx context.Context) (*Manifest, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	paths := []string{s.path}
+	if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(s.path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read manifest: %w", err)
+		}
+		sort.Strings(paths)
+	}
+
+	m := newManifest()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read manifest: %w", err)
+		}
+		if err := m.parse(data); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+		}
+	}
+
+	return m, nil
+}
+
+type redisSource struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// RedisSource loads a manifest stored as a JSON string in a Redis key
+func RedisSource(client redis.UniversalClient, key string) Source {
+	return redisSource{client: client, key: key}
+}
+
+func (s redisSource) Load(ctx context.Context) (*Manifest, error) {
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest from redis key %s: %w", s.key, err)
+	}
+
+	m := newManifest()
+	if err := m.parse(data); err != nil {
+		return nil, fmt.Errorf("invalid manifest in redis key %s: %w", s.key, err)
+	}
+
+	return m, nil
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		documents: map[string]string{},
+		hashes:    map[string]struct{}{},
+	}
+}
+
+// Len returns the number of approved operations
+func (m *Manifest) Len() int {
+	return len(m.documents)
+}
+
+// Document returns the query of the operation with the ID
+func (m *Manifest) Document(id string) (string, bool) {
+	query, ok := m.documents[id]
+	return query, ok
+}
+
+// Contains reports whether query is the document of an approved operation
+func (m *Manifest) Contains(query string) bool {
+	_, ok := m.hashes[hash(query)]
+	return ok
+}
+
+// parse adds the operations from an Apollo persisted query manifest, or from
+// a Relay persisted queries file mapping IDs to queries
+func (m *Manifest) parse(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	// a Relay file may have an operation with the ID "operations", but its
+	// value is a query rather than a list of operations
+	if operations, ok := raw["operations"]; ok && bytes.HasPrefix(bytes.TrimSpace(operations), []byte("[")) {
+		var apollo apolloManifest
+		if err := json.Unmarshal(data, &apollo); err != nil {
+			return err
+		}
+		if apollo.Format != "" && apollo.Format != apolloManifestFormat {
+			return fmt.Errorf("unsupported manifest format %q", apollo.Format)
+		}
+
+		for _, op := range apollo.Operations {
+			if op.ID == "" || op.Body == "" {
+				return errors.New("operations require an id and body")
+			}
+			m.add(op.ID, op.Body)
+		}
+		return nil
+	}
+
+	var relay map[string]string
+	if err := json.Unmarshal(data, &relay); err != nil {
+		return fmt.Errorf("expected an Apollo manifest or a map of IDs to queries: %w", err)
+	}
+	for id, query := range relay {
+		m.add(id, query)
+	}
+
+	return nil
+}
+
+func (m *Manifest) add(id, query string) {
+	m.documents[id] = query
+	m.hashes[hash(query)] = struct{}{}
+}
+
+func hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package safelist
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	// ErrNotInListCode is returned for persisted queries missing from the manifest
+	ErrNotInListCode = "PERSISTED_QUERY_NOT_IN_LIST"
+	// ErrIDRequiredCode is returned for free-form queries missing from the manifest
+	ErrIDRequiredCode = "PERSISTED_QUERY_ID_REQUIRED"
+
+	persistedQueryExtension = "persistedQuery"
+)
+
+// Safelist only allows operations from a manifest of approved operations to be
+// executed. Clients send the ID of an operation as an automatic persisted query
+// hash, and the query is taken from the manifest.
+//
+// The extension must be added to the handler before AutomaticPersistedQuery
+type Safelist struct {
+	Config Config
+	Logger *logrus.Entry
+
+	source   Source
+	manifest atomic.Pointer[Manifest]
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates the extension and loads the manifest from source. When
+// Config.ReloadInterval is set the manifest is reloaded until Close is called
+func New(cfg Config, source Source, logger *logrus.Entry) (*Safelist, error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	s := &Safelist{
+		Config: cfg,
+		Logger: logger,
+		source: source,
+		stop:   make(chan struct{}),
+	}
+
+	if err := s.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	logger.WithFields(logrus.Fields{
+		"mode":       cfg.Mode,
+		"operations": s.manifest.Load().Len(),
+	}).Info("safelist enabled")
+
+	if cfg.ReloadInterval > 0 {
+		s.wg.Add(1)
+		go s.watch()
+	}
+
+	return s, nil
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = &Safelist{}
+
+func (s *Safelist) ExtensionName() string {
+	return "Safelist"
+}
+
+func (s *Safelist) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (s *Safelist) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if s.Config.Mode == ModeOff {
+		return nil
+	}
+
+	manifest := s.manifest.Load()
+
+	if id, ok := persistedQueryID(params); ok {
+		query, ok := manifest.Document(id)
+		if !ok {
+			return s.reject(ctx, params, ErrNotInListCode, "persisted query is not in the safelist")
+		}
+
+		// the ID is not necessarily a hash of the query, so the query is
+		// resolved here instead of by AutomaticPersistedQuery
+		params.Query = query
+		delete(params.Extensions, persistedQueryExtension)
+		return nil
+	}
+
+	if manifest.Contains(params.Query) {
+		return nil
+	}
+
+	return s.reject(ctx, params, ErrIDRequiredCode, "only safelisted persisted queries may be executed")
+}
+
+// Reload loads the manifest from the source, keeping the current manifest on error
+func (s *Safelist) Reload(ctx context.Context) error {
+	manifest, err := s.source.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.manifest.Store(manifest)
+	s.Logger.WithField("operations", manifest.Len()).Debug("loaded safelist manifest")
+
+	return nil
+}
+
+// Close stops reloading the manifest
+func (s *Safelist) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Safelist) watch() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.Config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Reload(context.Background()); err != nil {
+				s.Logger.WithError(err).Error("could not reload safelist manifest")
+			}
+		}
+	}
+}
+
+// reject logs an operation missing from the manifest, and returns an error
+// when the safelist is enforced
+func (s *Safelist) reject(ctx context.Context, params *graphql.RawParams, code, message string) *gqlerror.Error {
+	logger := middleware.LogrusFromContext(ctx)
+	if logger == nil {
+		logger = s.Logger
+	}
+
+	logger.WithFields(logrus.Fields{
+		"operation": params.OperationName,
+		"code":      code,
+		"enforced":  s.Config.Mode == ModeEnforce,
+	}).Warn("operation is not in the safelist")
+
+	if s.Config.Mode != ModeEnforce {
+		return nil
+	}
+
+	return &gqlerror.Error{
+		Message: message,
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
+
+func persistedQueryID(params *graphql.RawParams) (string, bool) {
+	extension, ok := params.Extensions[persistedQueryExtension].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	id, ok := extension["sha256Hash"].(string)
+	return id, ok && id != ""
+}
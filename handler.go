@@ -1,20 +1,21 @@
 package gqlserver
 
 import (
-	"context"
 	"net/http"
 	"time"
 
-	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/graphql/limits"
+	"github.com/sirupsen/logrus"
 )
 
-func graphqlHandler(handler *handler.Server, cfg ServerConfig) gin.HandlerFunc {
+func graphqlHandler(handler *handler.Server, cfg ServerConfig, authenticator auth.Authenticator, logger *logrus.Entry, introspectionEnabled func() bool) gin.HandlerFunc {
 	var webSocketUpgradeCheckOrigin func(r *http.Request) bool
 
 	if cfg.IgnoreWebSocketUpgradeCheck {
@@ -23,11 +24,17 @@ func graphqlHandler(handler *handler.Server, cfg ServerConfig) gin.HandlerFunc {
 		webSocketUpgradeCheckOrigin = nil
 	}
 
+	var webSocketInitFunc transport.WebsocketInitFunc
+	if authenticator != nil {
+		webSocketInitFunc = websocketInitFunc(authenticator)
+	}
+
 	handler.AddTransport(transport.Websocket{
 		KeepAlivePingInterval: 10 * time.Second,
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: webSocketUpgradeCheckOrigin,
 		},
+		InitFunc: webSocketInitFunc,
 	})
 	handler.AddTransport(transport.Options{})
 	handler.AddTransport(transport.GET{})
@@ -44,56 +51,75 @@ func graphqlHandler(handler *handler.Server, cfg ServerConfig) gin.HandlerFunc {
 		handler.SetQueryCache(cfg.QueryCache)
 	}
 
-	if cfg.PlaygroundEnabled || cfg.IntrospectionEnabled {
-		handler.Use(extension.Introspection{})
-	}
+	// introspection is checked for each operation, so that it can be reloaded
+	handler.Use(introspection{
+		enabled: introspectionEnabled,
+	})
 
-	if cfg.ComplexityLimit > 0 {
-		handler.Use(&extension.ComplexityLimit{
-			Func: func(ctx context.Context, rc *graphql.OperationContext) int {
-				return cfg.ComplexityLimit
-			},
+	// limits are added after AutomaticPersistedQuery so that the token limit
+	// applies to the query it resolves
+	if cfg.Limits.Enabled() {
+		handler.Use(limits.Limits{
+			Config: cfg.Limits,
+			Logger: logger,
 		})
 	}
 
 	return func(c *gin.Context) {
-		handler.ServeHTTP(c.Writer, c.Request)
+		var w http.ResponseWriter = c.Writer
+		r := c.Request
+		if webSocketInitFunc != nil && r.Header.Get("Upgrade") != "" {
+			w, r = withWebsocketClose(w, r)
+		}
+
+		handler.ServeHTTP(w, r)
 	}
 }
 
-func playgroundHandler(cfg ServerConfig) gin.HandlerFunc {
+// playgroundHandler serves the playground while it is enabled, so that it
+// can be reloaded
+func playgroundHandler(cfg ServerConfig, enabled func() bool) gin.HandlerFunc {
 	playground := playground.Handler("GraphQL Playground", cfg.GraphqlPath)
 	return func(c *gin.Context) {
+		if !enabled() {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
 		playground.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
-func healthHandler() gin.HandlerFunc {
-	// TODO(Max): Implement real health checks
-	return func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	}
-}
+func (s *Server) registerRoutes() {
+	cfg := s.config
+	router := &s.router.RouterGroup
 
-func readyHandler() gin.HandlerFunc {
-	// TODO(Max): Implement real ready checks
-	return func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	}
-}
+	router.GET("/health", s.health.Handler())
+	router.GET("/ready", s.readiness.Handler())
+
+	// transports and extensions must only be added to the handler once
+	graphql := graphqlHandler(s.handler, cfg, s.auth, s.Logger, s.reloader.introspectionEnabled)
 
-func registerRoutes(handler *handler.Server, router *gin.RouterGroup, cfg ServerConfig) {
-	router.GET("/health", healthHandler())
-	router.GET("/ready", readyHandler())
+	// rate limited requests are rejected before they are tracked
+	handlers := append(s.rateLimit[:len(s.rateLimit):len(s.rateLimit)], s.lifecycle.trackOperation, graphql)
 
 	if cfg.ApqCache != nil {
-		router.GET(cfg.GraphqlPath, graphqlHandler(handler, cfg))
+		router.GET(cfg.GraphqlPath, handlers...)
 	}
 
-	router.POST(cfg.GraphqlPath, graphqlHandler(handler, cfg))
-	router.OPTIONS(cfg.GraphqlPath, graphqlHandler(handler, cfg))
+	router.POST(cfg.GraphqlPath, handlers...)
+	router.OPTIONS(cfg.GraphqlPath, graphql)
+
+	if cfg.PlaygroundPath != "" {
+		router.GET(cfg.PlaygroundPath, playgroundHandler(cfg, func() bool {
+			return s.reloader.current().PlaygroundEnabled
+		}))
+	}
+
+	if s.metrics != nil && cfg.Metrics.Port == 0 {
+		router.GET(cfg.Metrics.Path, gin.WrapH(s.metricsHandler()))
+	}
 
-	if cfg.PlaygroundEnabled {
-		router.GET(cfg.PlaygroundPath, playgroundHandler(cfg))
+	if cfg.Admin.ConfigPath != "" && cfg.Admin.Token != "" {
+		router.GET(cfg.Admin.ConfigPath, adminAuth(cfg.Admin.Token), s.configHandler())
 	}
 }
@@ -0,0 +1,15 @@
+package health
+
+import "time"
+
+type Config struct {
+	// Default time allowed for each check before it is reported as failed
+	CheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+
+	// Default time a check result is reused for before the check runs again
+	CacheTTL time.Duration `env:"HEALTH_CHECK_CACHE_TTL"`
+
+	// Include the errors of failing checks in the reports served on the main
+	// port. They are always included by the admin server
+	ShowErrors bool `env:"HEALTH_CHECK_SHOW_ERRORS"`
+}
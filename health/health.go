@@ -0,0 +1,256 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+)
+
+// CheckFunc reports an unhealthy dependency by returning an error
+type CheckFunc func(ctx context.Context) error
+
+// Pinger is implemented by clients which can check their own connectivity,
+// such as cache.RedisCache
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Option func(*check)
+
+// WithTimeout overrides the registry's default timeout for a check
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *check) {
+		c.timeout = timeout
+	}
+}
+
+// WithCacheTTL overrides how long the result of a check is reused for.
+// A TTL of 0 runs the check on every request.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *check) {
+		c.cacheTTL = ttl
+	}
+}
+
+// NonCritical marks a check as informational. A failing non-critical check is
+// reported but does not fail the overall status.
+func NonCritical() Option {
+	return func(c *check) {
+		c.critical = false
+	}
+}
+
+// Result of a single check
+type Result struct {
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Latency   string    `json:"latency"`
+	Error     string    `json:"error,omitempty"`
+	Cached    bool      `json:"cached"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report of every check in a registry
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	timeout  time.Duration
+	cacheTTL time.Duration
+	critical bool
+
+	mu      sync.Mutex
+	last    Result
+	lastRun time.Time
+}
+
+type Registry struct {
+	config Config
+
+	mu     sync.RWMutex
+	checks []*check
+}
+
+func NewRegistry(cfg Config) *Registry {
+	return &Registry{
+		config: cfg,
+	}
+}
+
+// Register adds a named check to the registry. Checks are critical by default.
+// Registering a check with an existing name replaces it.
+func (r *Registry) Register(name string, fn CheckFunc, opts ...Option) {
+	c := &check{
+		name:     name,
+		fn:       fn,
+		timeout:  r.config.CheckTimeout,
+		cacheTTL: r.config.CacheTTL,
+		critical: true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.checks {
+		if existing.name == name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+// Evaluate runs every check concurrently and reports a failure if any
+// critical check fails
+func (r *Registry) Evaluate(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]*check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.RUnlock()
+
+	report := Report{
+		Status: StatusPass,
+		Checks: make([]Result, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Critical && result.Status == StatusFail {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+// Handler serves the registry's report as JSON, responding with 503 Service
+// Unavailable when the report fails. Check errors can describe internal
+// dependencies, so are left out unless Config.ShowErrors is set
+func (r *Registry) Handler() gin.HandlerFunc {
+	return r.handler(func(report Report) interface{} {
+		if !r.config.ShowErrors {
+			for i := range report.Checks {
+				report.Checks[i].Error = ""
+			}
+		}
+		return report
+	})
+}
+
+// DetailHandler serves the registry's report as JSON including check errors,
+// responding with 503 Service Unavailable when the report fails. It should not
+// be exposed publicly
+func (r *Registry) DetailHandler() gin.HandlerFunc {
+	return r.handler(func(report Report) interface{} {
+		return report
+	})
+}
+
+func (r *Registry) handler(body func(Report) interface{}) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		report := r.Evaluate(ginContext.Request.Context())
+
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+
+		ginContext.Header("Cache-Control", "no-store")
+		ginContext.JSON(status, body(report))
+	}
+}
+
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cacheTTL > 0 && !c.lastRun.IsZero() && time.Since(c.lastRun) < c.cacheTTL {
+		result := c.last
+		result.Cached = true
+		return result
+	}
+
+	// the check isn't cancelled with the request, so that a client going away
+	// doesn't fail the cached result for everyone else
+	checkCtx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		checkCtx, cancel = context.WithTimeout(checkCtx, c.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := c.call(ctx, checkCtx)
+	latency := time.Since(start)
+
+	result := Result{
+		Name:      c.name,
+		Status:    StatusPass,
+		Critical:  c.critical,
+		Latency:   latency.String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	// a check abandoned by its caller has no result to cache
+	if ctx.Err() == nil {
+		c.last = result
+		c.lastRun = start
+	}
+
+	return result
+}
+
+// call runs the check with checkCtx, returning early if the check does not
+// respect it or the caller's ctx is done
+func (c *check) call(ctx, checkCtx context.Context) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- c.fn(checkCtx)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-checkCtx.Done():
+		return checkCtx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
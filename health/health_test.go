@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCancelledEvaluateIsNotCached(t *testing.T) {
+	registry := NewRegistry(Config{CheckTimeout: time.Second, CacheTTL: time.Minute})
+	registry.Register("slow", func(ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := registry.Evaluate(ctx); report.Status != StatusFail {
+		t.Fatalf("expected a cancelled evaluation to fail, got %s", report.Status)
+	}
+
+	report := registry.Evaluate(context.Background())
+	if report.Status != StatusPass {
+		t.Fatalf("expected the check to run again and pass, got %s", report.Status)
+	}
+	if report.Checks[0].Cached {
+		t.Fatal("expected the cancelled result not to be cached")
+	}
+}
+
+func TestHandlerReportsChecksWithoutErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		showErrors bool
+		detail     bool
+		error      string
+	}{
+		{name: "handler", error: ""},
+		{name: "handler showing errors", showErrors: true, error: "redis unavailable"},
+		{name: "detail handler", detail: true, error: "redis unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(Config{ShowErrors: tt.showErrors})
+			registry.Register("redis", func(ctx context.Context) error {
+				return errors.New("redis unavailable")
+			})
+
+			handler := registry.Handler()
+			if tt.detail {
+				handler = registry.DetailHandler()
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/ready", handler)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected status 503, got %d", recorder.Code)
+			}
+
+			var report Report
+			if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Checks) != 1 || report.Checks[0].Name != "redis" || report.Checks[0].Status != StatusFail {
+				t.Fatalf("expected the failing redis check to be reported, got %+v", report.Checks)
+			}
+			if report.Checks[0].Error != tt.error {
+				t.Fatalf("expected error %q, got %q", tt.error, report.Checks[0].Error)
+			}
+		})
+	}
+}
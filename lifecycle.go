@@ -0,0 +1,146 @@
+package gqlserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// drainPollInterval is how often active operations are checked while draining
+const drainPollInterval = 100 * time.Millisecond
+
+// flushTimeout is how long buffered telemetry is given to be sent once the
+// server has shut down, separate from the drain so a slow drain doesn't drop it
+const flushTimeout = 5 * time.Second
+
+// lifecycle holds the state shared between a running Server and its shutdown.
+// It is kept behind a pointer so that Server can continue to be passed by value.
+type lifecycle struct {
+	mu         sync.Mutex
+	httpServer *http.Server
+	routesOnce sync.Once
+	cancelBase context.CancelFunc
+
+	// servers started and shut down alongside the main server, such as metrics
+	extraServers []*http.Server
+
+	// number of GraphQL requests currently being handled, including
+	// websocket connections which are hijacked from the http.Server
+	active atomic.Int64
+
+	shuttingDown atomic.Bool
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+	done         chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		done: make(chan struct{}),
+	}
+}
+
+// newHTTPServer creates the http.Server owned by this lifecycle. Every request
+// context derives from a base context which is cancelled once draining has
+// finished, closing any remaining websocket subscriptions.
+func (l *lifecycle) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	baseCtx, cancel := context.WithCancel(context.Background())
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	l.mu.Lock()
+	l.httpServer = srv
+	l.cancelBase = cancel
+	l.mu.Unlock()
+
+	return srv
+}
+
+// addServer registers a server to be shut down after the main server has drained
+func (l *lifecycle) addServer(srv *http.Server) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.extraServers = append(l.extraServers, srv)
+}
+
+// shutdownExtraServers gracefully shuts down every additional server
+func (l *lifecycle) shutdownExtraServers(ctx context.Context) {
+	l.mu.Lock()
+	servers := l.extraServers
+	l.mu.Unlock()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+		}
+	}
+}
+
+func (l *lifecycle) server() *http.Server {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.httpServer
+}
+
+// closeConnections cancels the base context of all requests and forcibly
+// closes any connections that are still open
+func (l *lifecycle) closeConnections() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancelBase != nil {
+		l.cancelBase()
+	}
+	if l.httpServer != nil {
+		l.httpServer.Close()
+	}
+}
+
+// trackOperation is a gin handler that counts the GraphQL requests and
+// subscriptions currently in progress
+func (l *lifecycle) trackOperation(ginContext *gin.Context) {
+	l.active.Add(1)
+	defer l.active.Add(-1)
+
+	ginContext.Next()
+}
+
+// wait blocks until there are no active operations or the context is done
+func (l *lifecycle) wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if l.active.Load() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// readinessCheck fails once a graceful shutdown has begun so that no new
+// traffic is routed to the server while it drains
+func (l *lifecycle) readinessCheck(ctx context.Context) error {
+	if l.shuttingDown.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
+}
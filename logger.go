@@ -0,0 +1,88 @@
+package gqlserver
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LogFormatJSON   = "json"
+	LogFormatText   = "text"
+	LogFormatLogfmt = "logfmt"
+)
+
+// newLogger creates the logger owned by a server, or uses the logger from
+// the config, with the service, environment and hostname as fields
+func newLogger(cfg ServerConfig) (*logrus.Entry, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		formatter, err := newLogFormatter(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		logger = logrus.New()
+		logger.SetOutput(os.Stdout)
+		logger.SetLevel(cfg.LogLevel)
+		logger.SetFormatter(formatter)
+	}
+
+	hostname, _ := os.Hostname()
+
+	return logger.WithFields(logrus.Fields{
+		"service":  cfg.ServiceName,
+		"env":      cfg.Environment,
+		"hostname": hostname,
+	}), nil
+}
+
+func newLogFormatter(cfg ServerConfig) (logrus.Formatter, error) {
+	fieldMap := logrus.FieldMap{}
+	for key, renamed := range cfg.LogFieldMap {
+		// logrus only accepts its own constants as field map keys
+		switch key {
+		case logrus.FieldKeyMsg:
+			fieldMap[logrus.FieldKeyMsg] = renamed
+		case logrus.FieldKeyLevel:
+			fieldMap[logrus.FieldKeyLevel] = renamed
+		case logrus.FieldKeyTime:
+			fieldMap[logrus.FieldKeyTime] = renamed
+		case logrus.FieldKeyLogrusError:
+			fieldMap[logrus.FieldKeyLogrusError] = renamed
+		case logrus.FieldKeyFunc:
+			fieldMap[logrus.FieldKeyFunc] = renamed
+		case logrus.FieldKeyFile:
+			fieldMap[logrus.FieldKeyFile] = renamed
+		default:
+			return nil, fmt.Errorf("unknown log field %q", key)
+		}
+	}
+
+	switch cfg.LogFormat {
+	case LogFormatJSON, "":
+		return &logrus.JSONFormatter{
+			FieldMap: fieldMap,
+		}, nil
+	case LogFormatText:
+		return &logrus.TextFormatter{
+			FullTimestamp: true,
+			FieldMap:      fieldMap,
+		}, nil
+	case LogFormatLogfmt:
+		// key=value pairs whatever the output, with values quoted when they
+		// contain spaces or symbols and empty values kept as ""
+		return &logrus.TextFormatter{
+			DisableColors:    true,
+			DisableQuote:     false,
+			QuoteEmptyFields: true,
+			FullTimestamp:    true,
+			TimestampFormat:  time.RFC3339Nano,
+			FieldMap:         fieldMap,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+}
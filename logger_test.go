@@ -0,0 +1,41 @@
+package gqlserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogfmtFormat(t *testing.T) {
+	formatter, err := newLogFormatter(ServerConfig{
+		LogFormat:   LogFormatLogfmt,
+		LogFieldMap: map[string]string{"msg": "message"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &logrus.Entry{
+		Logger:  logrus.New(),
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Level:   logrus.InfoLevel,
+		Message: "request handled",
+		Data: logrus.Fields{
+			"path":   "/graphql",
+			"query":  `{ me { name } }`,
+			"empty":  "",
+			"status": 200,
+		},
+	}
+
+	line, err := formatter.Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `time="2024-01-02T03:04:05.000000006Z" level=info message="request handled" empty="" path=/graphql query="{ me { name } }" status=200` + "\n"
+	if string(line) != expected {
+		t.Fatalf("unexpected logfmt line\n got: %s\nwant: %s", line, expected)
+	}
+}
@@ -1,38 +1,212 @@
 package gqlserver
 
 import (
-	"log"
+	"context"
+	"sync"
+	"sync/atomic"
 
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// NrLogDropNewest drops new entries when the buffer is full
+	NrLogDropNewest = "newest"
+	// NrLogDropOldest drops the oldest buffered entry to make room for new entries
+	NrLogDropOldest = "oldest"
+)
+
+type NewRelicLogsConfig struct {
+	// Minimum level of log entries forwarded to New Relic
+	MinLevel logrus.Level `env:"NEW_RELIC_LOG_LEVEL"`
+
+	// Number of entries buffered while waiting to be forwarded
+	BufferSize int `env:"NEW_RELIC_LOG_BUFFER_SIZE"`
+
+	// Entries dropped when the buffer is full, "newest" or "oldest"
+	DropPolicy string `env:"NEW_RELIC_LOG_DROP_POLICY"`
+}
+
+// LogrusNewrelicHook forwards log entries to New Relic from a background
+// worker, so logging never waits on the agent, until it is closed.
+//
+// Fields are sent as attributes of the log, along with the trace.id and
+// span.id of the request, linking logs to traces in the UI. The agent sends
+// the logs it has recorded in batches with each harvest
 type LogrusNewrelicHook struct {
 	nrApp *newrelic.Application
+	cfg   NewRelicLogsConfig
+
+	entries chan *logrus.Entry
+	flushes chan chan struct{}
+	dropped atomic.Uint64
+
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
 }
 
-func NewLogrusNewrelicHook(nrApp *newrelic.Application) *LogrusNewrelicHook {
-	return &LogrusNewrelicHook{
-		nrApp: nrApp,
+func NewLogrusNewrelicHook(nrApp *newrelic.Application, cfg NewRelicLogsConfig) *LogrusNewrelicHook {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1
+	}
+
+	h := &LogrusNewrelicHook{
+		nrApp:   nrApp,
+		cfg:     cfg,
+		entries: make(chan *logrus.Entry, cfg.BufferSize),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
+
+	go h.run()
+
+	return h
 }
 
 func (h *LogrusNewrelicHook) Fire(entry *logrus.Entry) error {
-	line, err := entry.String()
-	if err != nil {
-		log.Printf("NrHook failed to fire. Unable to read entry, %v", err)
-		return err
+	select {
+	case <-h.stop:
+		return nil
+	default:
 	}
 
-	h.nrApp.RecordLog(newrelic.LogData{
-		Severity:  entry.Level.String(),
-		Message:   line,
-		Timestamp: entry.Time.UnixMilli(),
-	})
+	// the entry is recorded by the worker, so is copied with its linking
+	// metadata while the request context is still valid
+	data := make(logrus.Fields, len(entry.Data)+3)
+	for k, v := range entry.Data {
+		// errors marshal to empty JSON objects, so are sent as their message
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+	if entry.Context != nil {
+		linkingMetadata(entry.Context, data)
+	}
+
+	queued := &logrus.Entry{
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Message: entry.Message,
+	}
+
+	select {
+	case h.entries <- queued:
+		return nil
+	default:
+	}
+
+	if h.cfg.DropPolicy == NrLogDropOldest {
+		select {
+		case <-h.entries:
+			h.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case h.entries <- queued:
+			return nil
+		default:
+		}
+	}
 
+	h.dropped.Add(1)
 	return nil
 }
 
 func (h *LogrusNewrelicHook) Levels() []logrus.Level {
-	return logrus.AllLevels
+	levels := make([]logrus.Level, 0, len(logrus.AllLevels))
+	for _, level := range logrus.AllLevels {
+		if level <= h.cfg.MinLevel {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// Dropped returns the number of entries dropped because the buffer was full
+func (h *LogrusNewrelicHook) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+// Flush waits until the entries buffered before it was called are forwarded
+func (h *LogrusNewrelicHook) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case h.flushes <- done:
+	case <-h.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the worker. Entries still buffered are dropped, so the hook
+// should be flushed first. Entries fired after Close are ignored
+func (h *LogrusNewrelicHook) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.stop)
+	})
+	<-h.stopped
+	return nil
+}
+
+func (h *LogrusNewrelicHook) run() {
+	defer close(h.stopped)
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case entry := <-h.entries:
+			h.record(entry)
+		case done := <-h.flushes:
+			for n := len(h.entries); n > 0; n-- {
+				h.record(<-h.entries)
+			}
+			close(done)
+		}
+	}
+}
+
+func (h *LogrusNewrelicHook) record(entry *logrus.Entry) {
+	h.nrApp.RecordLog(newrelic.LogData{
+		Severity:   entry.Level.String(),
+		Message:    entry.Message,
+		Timestamp:  entry.Time.UnixMilli(),
+		Attributes: entry.Data,
+	})
+}
+
+// linkingMetadata adds the trace and span of the New Relic transaction or
+// OpenTelemetry span in ctx to data
+func linkingMetadata(ctx context.Context, data logrus.Fields) {
+	if tx := newrelic.FromContext(ctx); tx != nil {
+		metadata := tx.GetLinkingMetadata()
+		if metadata.TraceID != "" {
+			data["trace.id"] = metadata.TraceID
+			data["span.id"] = metadata.SpanID
+		}
+		if metadata.EntityGUID != "" {
+			data["entity.guid"] = metadata.EntityGUID
+		}
+		return
+	}
+
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		data["trace.id"] = sc.TraceID().String()
+		data["span.id"] = sc.SpanID().String()
+	}
 }
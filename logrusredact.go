@@ -0,0 +1,58 @@
+package gqlserver
+
+import (
+	"github.com/maxtroughear/gqlserver/redact"
+	"github.com/sirupsen/logrus"
+)
+
+// LogrusRedactHook masks sensitive fields and text in log entries. Hooks fire
+// in the order they were added, so it must fire before any other hook for them
+// to only see redacted entries
+type LogrusRedactHook struct {
+	redactor *redact.Redactor
+}
+
+func NewLogrusRedactHook(redactor *redact.Redactor) *LogrusRedactHook {
+	return &LogrusRedactHook{
+		redactor: redactor,
+	}
+}
+
+func (h *LogrusRedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.String(entry.Message)
+
+	// entry.Data is copied for each log line, so can be modified in place
+	for key, value := range entry.Data {
+		if h.redactor.Key(key) {
+			entry.Data[key] = redact.Placeholder
+			continue
+		}
+
+		if err, ok := value.(error); ok {
+			msg := err.Error()
+			if redacted := h.redactor.String(msg); redacted != msg {
+				entry.Data[key] = redacted
+			}
+			continue
+		}
+
+		entry.Data[key] = h.redactor.Value(value)
+	}
+
+	return nil
+}
+
+func (h *LogrusRedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// addFirstHook adds hook to logger so that it fires before the hooks already added
+func addFirstHook(logger *logrus.Logger, hook logrus.Hook) {
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(hook)
+
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append(hooks[level], levelHooks...)
+	}
+	logger.ReplaceHooks(hooks)
+}
@@ -0,0 +1,35 @@
+package gqlserver
+
+import (
+	"io"
+	"testing"
+
+	"github.com/maxtroughear/gqlserver/redact"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSuppliedLoggerHooksSeeRedactedEntries(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	hook := test.NewLocal(logger)
+
+	cfg := DefaultConfig
+	cfg.Logger = logger
+	cfg.ReloadInterval = 0
+	cfg.Redact.Mode = redact.ModeOn
+	NewServer(websocketTestSchema{}, cfg)
+
+	logger.WithField("password", "hunter2").Info("signed in as someone@example.com")
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("expected the existing hook to fire")
+	}
+	if entry.Data["password"] != redact.Placeholder {
+		t.Fatalf("expected the existing hook to see a redacted field, got %v", entry.Data["password"])
+	}
+	if entry.Message != "signed in as "+redact.Placeholder {
+		t.Fatalf("expected the existing hook to see a redacted message, got %q", entry.Message)
+	}
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type AccessLogConfig struct {
+	// Log a line when each request completes
+	Enabled bool `env:"ACCESS_LOG_ENABLED"`
+
+	// Fraction of successful requests to log, between 0 and 1.
+	// Failed and slow requests are always logged
+	SampleRate float64 `env:"ACCESS_LOG_SAMPLE_RATE"`
+
+	// Requests taking longer are logged as slow, 0 disables slow request logging.
+	// Websocket connections are never slow
+	SlowThreshold time.Duration `env:"ACCESS_LOG_SLOW_THRESHOLD"`
+
+	// Paths which are never logged, e.g. "/health"
+	SkipPaths []string `env:"ACCESS_LOG_SKIP_PATHS"`
+}
+
+type requestInfoContextKey struct{}
+
+// RequestInfo collects details of a request from later handlers to include
+// in the access log. Methods may be called on a nil RequestInfo
+type RequestInfo struct {
+	mu            sync.Mutex
+	userID        string
+	operationName string
+	operationType string
+}
+
+// RequestInfoFromContext returns the RequestInfo of the current request,
+// or nil if the access log is disabled
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoContextKey{}).(*RequestInfo)
+	return info
+}
+
+// SetUserID records the authenticated user
+func (i *RequestInfo) SetUserID(id string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.userID = id
+}
+
+// SetOperation records the GraphQL operation
+func (i *RequestInfo) SetOperation(name, operationType string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.operationName = name
+	i.operationType = operationType
+}
+
+func (i *RequestInfo) fields() logrus.Fields {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	fields := logrus.Fields{}
+	if i.userID != "" {
+		fields["user.id"] = i.userID
+	}
+	if i.operationName != "" {
+		fields["graphql.operation.name"] = i.operationName
+	}
+	if i.operationType != "" {
+		fields["graphql.operation.type"] = i.operationType
+	}
+	return fields
+}
+
+// AccessLogMiddleware logs each request once it completes, using the logger
+// from LogrusMiddleware so must run after it
+func AccessLogMiddleware(cfg AccessLogConfig) gin.HandlerFunc {
+	skip := make(map[string]struct{}, len(cfg.SkipPaths))
+	for _, path := range cfg.SkipPaths {
+		skip[path] = struct{}{}
+	}
+
+	return func(ginContext *gin.Context) {
+		if _, ok := skip[ginContext.Request.URL.Path]; ok {
+			ginContext.Next()
+			return
+		}
+
+		start := time.Now()
+		info := &RequestInfo{}
+		body := &countingReader{ReadCloser: ginContext.Request.Body}
+		if ginContext.Request.Body != nil {
+			ginContext.Request.Body = body
+		}
+
+		ctx := context.WithValue(ginContext.Request.Context(), requestInfoContextKey{}, info)
+		ginContext.Request = ginContext.Request.WithContext(ctx)
+
+		// panics are logged before being recovered by an earlier handler
+		completed := false
+		defer func() {
+			status := ginContext.Writer.Status()
+			if !completed {
+				status = http.StatusInternalServerError
+			}
+			logAccess(ginContext, cfg, info, status, body.n, time.Since(start))
+		}()
+
+		ginContext.Next()
+		completed = true
+	}
+}
+
+func logAccess(ginContext *gin.Context, cfg AccessLogConfig, info *RequestInfo, status int, requestSize int64, latency time.Duration) {
+	websocket := strings.EqualFold(ginContext.GetHeader("Upgrade"), "websocket")
+	slow := cfg.SlowThreshold > 0 && latency > cfg.SlowThreshold && !websocket
+
+	failed := status >= http.StatusBadRequest
+	if !failed && !slow && (cfg.SampleRate <= 0 || (cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate)) {
+		return
+	}
+
+	logger := LogrusFromContext(ginContext.Request.Context())
+	if logger == nil {
+		return
+	}
+
+	// gin reports -1 when nothing was written
+	responseSize := ginContext.Writer.Size()
+	if responseSize < 0 {
+		responseSize = 0
+	}
+
+	fields := info.fields()
+	fields["http.status"] = status
+	fields["http.duration_ms"] = float64(latency.Microseconds()) / 1000
+	fields["http.request_size"] = requestSize
+	fields["http.response_size"] = responseSize
+	fields["http.client_ip"] = ginContext.ClientIP()
+	fields["http.user_agent"] = ginContext.Request.UserAgent()
+	if websocket {
+		fields["http.websocket"] = true
+	}
+	if slow {
+		fields["http.slow"] = true
+	}
+
+	entry := logger.WithFields(fields)
+	switch {
+	case status >= http.StatusInternalServerError:
+		entry.Error("request completed")
+	case failed || slow:
+		entry.Warn("request completed")
+	default:
+		entry.Info("request completed")
+	}
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
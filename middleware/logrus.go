@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type logrusContextKey struct{}
@@ -24,7 +25,7 @@ func LogrusMiddleware(logger *logrus.Entry) gin.HandlerFunc {
 		tx := newrelic.FromContext(ctx)
 		if tx != nil {
 			metadata := tx.GetLinkingMetadata()
-			ginLogger = logger.WithFields(logrus.Fields{
+			ginLogger = ginLogger.WithFields(logrus.Fields{
 				"entity.name": metadata.EntityName,
 				"entity.guid": metadata.EntityGUID,
 				"entity.type": metadata.EntityType,
@@ -32,6 +33,15 @@ func LogrusMiddleware(logger *logrus.Entry) gin.HandlerFunc {
 				"trace.id":    metadata.TraceID,
 				"span.id":     metadata.SpanID,
 			})
+		} else if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			ginLogger = ginLogger.WithFields(logrus.Fields{
+				"trace.id": spanContext.TraceID().String(),
+				"span.id":  spanContext.SpanID().String(),
+			})
+		}
+
+		if requestID := RequestIDFromContext(ctx); requestID != "" {
+			ginLogger = ginLogger.WithField(requestIDAttribute, requestID)
 		}
 
 		newCtx := context.WithValue(ginContext.Request.Context(), logrusContextKey{}, ginLogger)
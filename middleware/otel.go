@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otelInstrumentationName = "github.com/maxtroughear/gqlserver/middleware"
+
+// OtelMiddleware starts a server span for each request, continuing any trace
+// propagated by the caller through W3C traceparent headers
+func OtelMiddleware(tracerProvider trace.TracerProvider, propagator propagation.TextMapPropagator, serviceName string) gin.HandlerFunc {
+	tracer := tracerProvider.Tracer(otelInstrumentationName)
+
+	return func(ginContext *gin.Context) {
+		request := ginContext.Request
+		ctx := propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		route := ginContext.FullPath()
+		spanName := route
+		if spanName == "" {
+			spanName = "HTTP " + request.Method
+		}
+
+		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serviceName, route, request)...),
+		)
+		defer span.End()
+
+		ginContext.Request = request.WithContext(ctx)
+		ginContext.Next()
+
+		status := ginContext.Writer.Status()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+		if len(ginContext.Errors) > 0 {
+			span.RecordError(ginContext.Errors.Last())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusMiddleware records the count, duration and size of HTTP requests
+// along with the number of active websocket connections. Requests are labelled
+// by their route pattern rather than path to keep label cardinality bounded.
+func PrometheusMiddleware(registerer prometheus.Registerer) gin.HandlerFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled.",
+	}, []string{"method", "route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	responseSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "http",
+		Name:      "response_size_bytes",
+		Help:      "Size of HTTP responses.",
+		Buckets:   prometheus.ExponentialBuckets(100, 10, 6),
+	}, []string{"method", "route"})
+	websockets := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "http",
+		Name:      "websocket_connections_active",
+		Help:      "Number of websocket connections currently open.",
+	})
+
+	registerer.MustRegister(requests, duration, responseSize, websockets)
+
+	return func(ginContext *gin.Context) {
+		route := ginContext.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ginContext.Request.Method
+
+		// websocket connections are long lived so their duration is not recorded
+		if ginContext.GetHeader("Upgrade") != "" {
+			websockets.Inc()
+			defer websockets.Dec()
+
+			ginContext.Next()
+
+			requests.WithLabelValues(method, route, strconv.Itoa(ginContext.Writer.Status())).Inc()
+			return
+		}
+
+		start := time.Now()
+		ginContext.Next()
+
+		requests.WithLabelValues(method, route, strconv.Itoa(ginContext.Writer.Status())).Inc()
+		duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		if size := ginContext.Writer.Size(); size > 0 {
+			responseSize.WithLabelValues(method, route).Observe(float64(size))
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxtroughear/gqlserver/ratelimit"
+)
+
+const (
+	errRateLimitedCode = "RATE_LIMITED"
+
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	retryAfterHeader         = "Retry-After"
+
+	// anonymousOperationKey is shared by requests without an operation name
+	anonymousOperationKey = "operation:(anonymous)"
+)
+
+// KeyFunc identifies the client a request is limited by.
+// Requests with an empty key are not limited
+type KeyFunc func(c *gin.Context) string
+
+// RateLimit rejects requests exceeding the limiter's rate for the key with a
+// 429 response. When several rate limits apply, the headers describe the one
+// with the fewest remaining requests. Requests are allowed if the limiter fails
+func RateLimit(limiter ratelimit.Limiter, key KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), k)
+		if err != nil {
+			if log := LogrusFromContext(c.Request.Context()); log != nil {
+				log.WithError(err).Error("rate limit failed, request continuing")
+			}
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c.Writer.Header(), result)
+
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			c.Header(retryAfterHeader, strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"errors": []gin.H{{
+					"message": "rate limit exceeded, retry after " + strconv.Itoa(retryAfter) + "s",
+					"extensions": gin.H{
+						"code":       errRateLimitedCode,
+						"retryAfter": retryAfter,
+					},
+				}},
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func setRateLimitHeaders(header http.Header, result ratelimit.Result) {
+	if existing := header.Get(rateLimitRemainingHeader); existing != "" {
+		if remaining, err := strconv.Atoi(existing); err == nil && remaining <= result.Remaining {
+			return
+		}
+	}
+
+	header.Set(rateLimitLimitHeader, strconv.Itoa(result.Limit))
+	header.Set(rateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+	header.Set(rateLimitResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIPKey identifies requests by client IP. Forwarded headers are only
+// used from the router's trusted proxies
+func ClientIPKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// OperationNameKey identifies requests by GraphQL operation name, from the
+// query string or a JSON body of at most maxBodyBytes. Anonymous operations
+// and larger bodies share one key, so they can't avoid operation limits
+func OperationNameKey(maxBodyBytes int64) KeyFunc {
+	return func(c *gin.Context) string {
+		name := c.Query("operationName")
+
+		if name == "" && c.Request.Method == http.MethodPost &&
+			strings.HasPrefix(c.ContentType(), "application/json") && c.Request.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodyBytes+1))
+			// the handler reads the whole body, including any part not read here
+			c.Request.Body = readCloser{
+				Reader: io.MultiReader(bytes.NewReader(body), c.Request.Body),
+				Closer: c.Request.Body,
+			}
+
+			if err == nil && int64(len(body)) <= maxBodyBytes {
+				var params struct {
+					OperationName string `json:"operationName"`
+				}
+				if json.Unmarshal(body, &params) == nil {
+					name = params.OperationName
+				}
+			}
+		}
+
+		if name == "" {
+			return anonymousOperationKey
+		}
+		return "operation:" + name
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// CombineKeys identifies requests by every key, e.g. the operation per client.
+// Requests are not limited if any key is empty
+func CombineKeys(keys ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			k := key(c)
+			if k == "" {
+				return ""
+			}
+			parts = append(parts, k)
+		}
+		return strings.Join(parts, "|")
+	}
+}
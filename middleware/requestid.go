@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultRequestIDHeader = "X-Request-ID"
+
+	requestIDAttribute = "request.id"
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKey struct{}
+
+// RequestIDMiddleware identifies each request by the ID in header, or a new
+// ULID if the request has no valid ID. The ID is stored in the context, echoed
+// in the response header and added to the New Relic transaction and OTel span,
+// so must run after their middleware
+func RequestIDMiddleware(header string) gin.HandlerFunc {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(ginContext *gin.Context) {
+		id := ginContext.GetHeader(header)
+		if !validRequestID(id) {
+			id = newULID(time.Now())
+		}
+
+		ctx := ginContext.Request.Context()
+
+		if tx := newrelic.FromContext(ctx); tx != nil {
+			tx.AddAttribute(requestIDAttribute, id)
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(requestIDAttribute, id))
+
+		ginContext.Header(header, id)
+
+		ctx = context.WithValue(ctx, requestIDContextKey{}, id)
+		ginContext.Request = ginContext.Request.WithContext(ctx)
+		ginContext.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID of the current request, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// validRequestID only accepts IDs which are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID creates a ULID, a 48 bit millisecond timestamp followed by 80 random
+// bits encoded as 26 characters of Crockford's base32
+func newULID(now time.Time) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(now.UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	// encode 128 bits as 26 characters of 5 bits, the first holding only 3 bits
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out[:])
+}
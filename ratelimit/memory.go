@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	limit  int
+	period time.Duration
+	// rate of tokens added per second
+	rate float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewTokenBucket creates a limiter local to this server allowing bursts of
+// up to limit requests, refilled evenly over period
+func NewTokenBucket(limit int, period time.Duration) Limiter {
+	return &tokenBucket{
+		limit:   limit,
+		period:  period,
+		rate:    float64(limit) / period.Seconds(),
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (l *tokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit), b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	l.sweep(now)
+
+	return tokenBucketResult(allowed, l.limit, l.rate, b.tokens), nil
+}
+
+// sweep removes full buckets, at most once per period
+func (l *tokenBucket) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.period {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func tokenBucketResult(allowed bool, limit int, rate, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(tokens),
+		Reset:     secondsToDuration((float64(limit) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return result
+}
+
+type slidingWindow struct {
+	limit  int
+	period time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep int64
+}
+
+type window struct {
+	index    int64
+	current  int
+	previous int
+}
+
+// NewSlidingWindow creates a limiter local to this server allowing limit
+// requests in any period. The sliding window is approximated from the
+// requests in the current and previous fixed windows
+func NewSlidingWindow(limit int, period time.Duration) Limiter {
+	return &slidingWindow{
+		limit:   limit,
+		period:  period,
+		windows: map[string]*window{},
+	}
+}
+
+func (l *slidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+	index := now.UnixNano() / int64(l.period)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{index: index}
+		l.windows[key] = w
+	}
+	switch {
+	case w.index == index-1:
+		w.previous, w.current = w.current, 0
+	case w.index < index-1:
+		w.previous, w.current = 0, 0
+	}
+	w.index = index
+
+	allowed := slidingCount(now, l.period, w.current, w.previous) < l.limit
+	if allowed {
+		w.current++
+	}
+
+	if l.lastSweep != index {
+		l.lastSweep = index
+		for key, w := range l.windows {
+			if w.index < index-1 {
+				delete(l.windows, key)
+			}
+		}
+	}
+
+	return slidingWindowResult(allowed, now, l.limit, l.period, w.current, w.previous), nil
+}
+
+// slidingCount weights the previous window by how much of it is still within
+// the sliding window
+func slidingCount(now time.Time, period time.Duration, current, previous int) int {
+	return current + int(math.Ceil(float64(previous)*(1-elapsed(now, period))))
+}
+
+// elapsed returns the fraction of the current fixed window which has passed
+func elapsed(now time.Time, period time.Duration) float64 {
+	return float64(now.UnixNano()%int64(period)) / float64(period)
+}
+
+func slidingWindowResult(allowed bool, now time.Time, limit int, period time.Duration, current, previous int) Result {
+	count := slidingCount(now, period, current, previous)
+	untilNext := time.Duration((1 - elapsed(now, period)) * float64(period))
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: limit - count,
+		// the current window's requests have left the sliding window one period
+		// after the next window begins
+		Reset: untilNext + period,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if !allowed {
+		// wait until enough of the previous window has left the sliding window
+		// for one more request, which may not happen until the next window
+		if current < limit && previous > 0 {
+			required := 1 - float64(limit-current-1)/float64(previous)
+			result.RetryAfter = time.Duration((required - elapsed(now, period)) * float64(period))
+		} else {
+			required := math.Max(0, 1-float64(limit-1)/float64(current))
+			result.RetryAfter = untilNext + time.Duration(required*float64(period))
+		}
+		if result.RetryAfter < 0 {
+			result.RetryAfter = 0
+		}
+	}
+
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
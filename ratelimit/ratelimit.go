@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmTokenBucket   = "token-bucket"
+	AlgorithmSlidingWindow = "sliding-window"
+
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Result of a request to a limiter
+type Result struct {
+	Allowed bool
+
+	// Limit is the number of requests allowed per period
+	Limit int
+
+	// Remaining is the number of requests which may be made immediately
+	Remaining int
+
+	// Reset is the time until the full limit is available again
+	Reset time.Duration
+
+	// RetryAfter is the time until a request will be allowed, when it was not
+	RetryAfter time.Duration
+}
+
+// Limiter limits the rate of requests for a key
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Rule limits requests identified by Key to Limit per Period.
+// Rules are written as "key:limit/period", e.g. "ip:100/1m"
+type Rule struct {
+	Key    string
+	Limit  int
+	Period time.Duration
+}
+
+func (r *Rule) UnmarshalText(text []byte) error {
+	key, rate, ok := strings.Cut(strings.TrimSpace(string(text)), ":")
+	if !ok {
+		return fmt.Errorf("invalid rate limit rule %q, expected key:limit/period", text)
+	}
+
+	limit, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return fmt.Errorf("invalid rate limit rule %q, expected key:limit/period", text)
+	}
+
+	var err error
+	if r.Limit, err = strconv.Atoi(limit); err != nil || r.Limit <= 0 {
+		return fmt.Errorf("invalid limit in rate limit rule %q", text)
+	}
+	if r.Period, err = time.ParseDuration(period); err != nil || r.Period <= 0 {
+		return fmt.Errorf("invalid period in rate limit rule %q", text)
+	}
+	r.Key = key
+
+	return nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%d/%s", r.Key, r.Limit, r.Period)
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript refills and takes a token from the bucket in KEYS[1].
+// Tokens are returned as a string as Lua numbers are truncated to integers
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1]) or limit
+local updated = tonumber(state[2]) or now
+
+tokens = math.min(limit, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], ttl)
+
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts a request in the window in KEYS[1] if the
+// approximate count over the sliding window, including the previous window in
+// KEYS[2], is below the limit
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+
+if current + math.ceil(previous * weight) >= limit then
+	return {0, current, previous}
+end
+
+current = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ttl)
+
+return {1, current, previous}
+`)
+
+type redisTokenBucket struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	period time.Duration
+	rate   float64
+}
+
+// NewRedisTokenBucket creates a token bucket limiter shared by every server
+// using the same Redis and prefix
+func NewRedisTokenBucket(client redis.UniversalClient, prefix string, limit int, period time.Duration) Limiter {
+	return &redisTokenBucket{
+		client: client,
+		prefix: "ratelimit:" + prefix + ":",
+		limit:  limit,
+		period: period,
+		rate:   float64(limit) / period.Seconds(),
+	}
+}
+
+func (l *redisTokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+
+	values, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key},
+		l.limit,
+		// tokens per millisecond
+		l.rate/1000,
+		now.UnixMilli(),
+		l.period.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	tokens, _ := strconv.ParseFloat(values[1].(string), 64)
+
+	return tokenBucketResult(allowed == 1, l.limit, l.rate, tokens), nil
+}
+
+type redisSlidingWindow struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	period time.Duration
+}
+
+// NewRedisSlidingWindow creates a sliding window limiter shared by every
+// server using the same Redis and prefix
+func NewRedisSlidingWindow(client redis.UniversalClient, prefix string, limit int, period time.Duration) Limiter {
+	return &redisSlidingWindow{
+		client: client,
+		prefix: "ratelimit:" + prefix + ":",
+		limit:  limit,
+		period: period,
+	}
+}
+
+func (l *redisSlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	now := time.Now()
+	index := now.UnixNano() / int64(l.period)
+
+	// the hash tag keeps both windows in the same slot of a Redis Cluster
+	base := l.prefix + "{" + key + "}:"
+
+	values, err := slidingWindowScript.Run(ctx, l.client,
+		[]string{
+			base + strconv.FormatInt(index, 10),
+			base + strconv.FormatInt(index-1, 10),
+		},
+		l.limit,
+		1-elapsed(now, l.period),
+		// kept while it is the current or previous window
+		(2 * l.period).Milliseconds(),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	current, _ := values[1].(int64)
+	previous, _ := values[2].(int64)
+
+	return slidingWindowResult(allowed == 1, now, l.limit, l.period, int(current), int(previous)), nil
+}
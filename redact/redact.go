@@ -0,0 +1,191 @@
+package redact
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// DefaultPatterns match the names of fields which commonly hold secrets
+var DefaultPatterns = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"authorization",
+	"api[-_]?key",
+	"credential",
+	"cookie",
+	"session",
+	"phone",
+}
+
+// DefaultValuePatterns match secrets and personal data within values:
+// JWTs, emails, card numbers and Authorization header values
+var DefaultValuePatterns = []string{
+	`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	`\b(?:\d[ -]?){12,18}\d\b`,
+	`(?i)\b(?:bearer|basic)\s+[A-Za-z0-9._~+/=-]+`,
+}
+
+type Mode string
+
+const (
+	// ModeAuto redacts logs in production only
+	ModeAuto Mode = "auto"
+	ModeOn   Mode = "on"
+	ModeOff  Mode = "off"
+)
+
+type Config struct {
+	// Whether log output is redacted, auto only redacts in production
+	Mode Mode `env:"REDACT_MODE"`
+
+	// Regular expressions matching the names of sensitive fields, case insensitive.
+	// Names only need to contain a match, e.g. "token" matches "refreshToken"
+	Patterns []string `env:"REDACT_PATTERNS"`
+
+	// Regular expressions matching sensitive text within values and messages.
+	// Digit sequences which look like card numbers are only redacted when they
+	// pass the Luhn check
+	ValuePatterns []string `env:"REDACT_VALUE_PATTERNS"`
+}
+
+// Redactor replaces the values of sensitive fields and sensitive text
+type Redactor struct {
+	keys   *regexp.Regexp
+	values *regexp.Regexp
+}
+
+// New creates a Redactor for fields with names matching any of the patterns,
+// and text matching any of the value patterns
+func New(cfg Config) (*Redactor, error) {
+	r := &Redactor{}
+
+	if len(cfg.Patterns) > 0 {
+		keys, err := regexp.Compile("(?i)(?:" + strings.Join(cfg.Patterns, ")|(?:") + ")")
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern: %w", err)
+		}
+		r.keys = keys
+	}
+
+	if len(cfg.ValuePatterns) > 0 {
+		values, err := regexp.Compile("(?:" + strings.Join(cfg.ValuePatterns, ")|(?:") + ")")
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact value pattern: %w", err)
+		}
+		r.values = values
+	}
+
+	return r, nil
+}
+
+// Key reports whether the value of the field named key is sensitive
+func (r *Redactor) Key(key string) bool {
+	return r != nil && r.keys != nil && r.keys.MatchString(key)
+}
+
+// String replaces sensitive text within s
+func (r *Redactor) String(s string) string {
+	if r == nil || r.values == nil {
+		return s
+	}
+
+	return r.values.ReplaceAllStringFunc(s, func(match string) string {
+		if cardNumberLike(match) && !luhn(match) {
+			return match
+		}
+		return Placeholder
+	})
+}
+
+// Value returns a copy of v with the values of sensitive fields and sensitive
+// text within strings replaced, searching nested maps, slices and headers
+func (r *Redactor) Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if r.Key(key) {
+				redacted[key] = Placeholder
+			} else {
+				redacted[key] = r.Value(value)
+			}
+		}
+		return redacted
+	case map[string][]string:
+		return r.multiMap(v)
+	case http.Header:
+		return http.Header(r.multiMap(v))
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = r.Value(value)
+		}
+		return redacted
+	case []string:
+		return r.strings(v)
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) multiMap(m map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(m))
+	for key, values := range m {
+		if r.Key(key) {
+			redacted[key] = []string{Placeholder}
+		} else {
+			redacted[key] = r.strings(values)
+		}
+	}
+	return redacted
+}
+
+func (r *Redactor) strings(values []string) []string {
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = r.String(value)
+	}
+	return redacted
+}
+
+// cardNumberLike reports whether s only holds digits, spaces and dashes
+func cardNumberLike(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && c != ' ' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum
+func luhn(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		d := int(s[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
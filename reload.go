@@ -0,0 +1,282 @@
+package gqlserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ConfigChange is a setting changed by a reload, with secrets masked
+type ConfigChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// reloader holds the settings which can change while the server is running
+type reloader struct {
+	mu     sync.Mutex
+	config atomic.Pointer[ServerConfig]
+	cors   atomic.Pointer[gin.HandlerFunc]
+
+	// settings which can be reloaded, depending on how the server was created
+	reloadable map[string]bool
+}
+
+func newReloader(cfg ServerConfig) *reloader {
+	r := &reloader{
+		reloadable: map[string]bool{
+			"PLAYGROUND_ENABLED":    true,
+			"INTROSPECTION_ENABLED": true,
+			"COMPLEXITY_LIMIT":      true,
+		},
+	}
+	r.config.Store(&cfg)
+
+	// the level of a logger passed in is left to its owner
+	if cfg.Logger == nil {
+		r.reloadable["LOG_LEVEL"] = true
+	}
+
+	if cfg.Cors.Enabled {
+		r.reloadable["CORS_ALLOW_ORIGINS"] = true
+		r.cors.Store(newCorsHandler(cfg))
+	}
+
+	return r
+}
+
+func newCorsHandler(cfg ServerConfig) *gin.HandlerFunc {
+	corsConfig := cfg.Cors
+	corsConfig.ExposeHeaders = append([]string{cfg.RequestIDHeader}, corsConfig.ExposeHeaders...)
+	handler := configureCorsMiddleware(corsConfig)
+	return &handler
+}
+
+// current returns the config with any reloaded settings
+func (r *reloader) current() *ServerConfig {
+	return r.config.Load()
+}
+
+// corsMiddleware applies the current CORS origins
+func (r *reloader) corsMiddleware(ginContext *gin.Context) {
+	(*r.cors.Load())(ginContext)
+}
+
+func (r *reloader) introspectionEnabled() bool {
+	cfg := r.current()
+	return cfg.PlaygroundEnabled || cfg.IntrospectionEnabled
+}
+
+// Reload reads the config again from the file and environment it was loaded
+// from. Settings which are safe to change while running are applied, other
+// changes are logged and ignored until the server is restarted
+func (s *Server) Reload() error {
+	r := s.reloader
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.current()
+	if current.load == nil {
+		return errors.New("config can only be reloaded when created by LoadConfig")
+	}
+
+	next, err := loadConfig(current.load)
+	if err != nil {
+		s.Logger.WithError(err).Error("config reload failed")
+		return err
+	}
+
+	changes := diffConfig(*current, next)
+	if len(changes) == 0 {
+		s.Logger.Debug("config unchanged")
+		return nil
+	}
+
+	applied := *current
+	applied.sources = copySources(current.sources)
+
+	var appliedChanges []ConfigChange
+	var restart []string
+	for _, change := range changes {
+		if !r.reloadable[change.Key] {
+			restart = append(restart, change.Key)
+			continue
+		}
+
+		switch change.Key {
+		case "LOG_LEVEL":
+			applied.LogLevel = next.LogLevel
+		case "COMPLEXITY_LIMIT":
+			applied.ComplexityLimit = next.ComplexityLimit
+		case "CORS_ALLOW_ORIGINS":
+			applied.Cors.AllowOrigins = next.Cors.AllowOrigins
+		case "PLAYGROUND_ENABLED":
+			applied.PlaygroundEnabled = next.PlaygroundEnabled
+		case "INTROSPECTION_ENABLED":
+			applied.IntrospectionEnabled = next.IntrospectionEnabled
+		}
+		if source, ok := next.sources[change.Key]; ok {
+			applied.sources[change.Key] = source
+		} else {
+			delete(applied.sources, change.Key)
+		}
+		appliedChanges = append(appliedChanges, change)
+	}
+
+	if len(restart) > 0 {
+		s.Logger.WithField("keys", restart).Warn("config changes require a restart and were not applied")
+	}
+	if len(appliedChanges) == 0 {
+		return nil
+	}
+
+	if applied.Cors.Enabled {
+		r.cors.Store(newCorsHandler(applied))
+	}
+	if applied.LogLevel != current.LogLevel {
+		s.Logger.Logger.SetLevel(applied.LogLevel)
+	}
+	r.config.Store(&applied)
+
+	s.Logger.WithField("changes", appliedChanges).Info("config reloaded")
+
+	return nil
+}
+
+// setLogLevel changes the level of logger until the config is next reloaded
+func (r *reloader) setLogLevel(logger *logrus.Logger, level logrus.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := *r.current()
+	cfg.LogLevel = level
+	cfg.sources = copySources(cfg.sources)
+	cfg.sources["LOG_LEVEL"] = ConfigSourceAdmin
+
+	logger.SetLevel(level)
+	r.config.Store(&cfg)
+}
+
+func copySources(sources map[string]string) map[string]string {
+	copied := make(map[string]string, len(sources)+1)
+	for key, source := range sources {
+		copied[key] = source
+	}
+	return copied
+}
+
+// diffConfig returns the settings which differ between old and new
+func diffConfig(old, new ServerConfig) []ConfigChange {
+	oldValues := configValues(old)
+	newValues := configValues(new)
+
+	var changes []ConfigChange
+	for i := range newValues {
+		if oldValues[i].Value == newValues[i].Value {
+			continue
+		}
+
+		change := ConfigChange{
+			Key: newValues[i].Key,
+			Old: oldValues[i].Value,
+			New: newValues[i].Value,
+		}
+		if newValues[i].Secret {
+			change.Old = maskedConfigValue
+			change.New = maskedConfigValue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// watchConfig reloads the config on SIGHUP, and when the config file changes
+func (s *Server) watchConfig(ctx context.Context) {
+	cfg := s.reloader.current()
+	if cfg.load == nil {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	var lastHash [sha256.Size]byte
+	if cfg.load.file != "" && cfg.ReloadInterval > 0 {
+		ticker := time.NewTicker(cfg.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+		lastHash, _ = hashFile(cfg.load.file)
+	}
+
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.Logger.Info("reloading config on SIGHUP")
+			s.Reload()
+		case <-tick:
+			hash, err := hashFile(cfg.load.file)
+			if err != nil {
+				s.Logger.WithError(err).Warn("failed to read config file")
+				continue
+			}
+			if hash == lastHash {
+				continue
+			}
+			lastHash = hash
+
+			s.Logger.WithField("file", cfg.load.file).Info("reloading changed config file")
+			s.Reload()
+		}
+	}
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// introspection enables introspection while the playground or introspection
+// is enabled, replacing extension.Introspection so that it can be reloaded
+type introspection struct {
+	enabled func() bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = introspection{}
+
+func (i introspection) ExtensionName() string {
+	return "Introspection"
+}
+
+func (i introspection) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (i introspection) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	if i.enabled() {
+		rc.DisableIntrospection = false
+	}
+	return nil
+}
@@ -1,22 +1,45 @@
 package gqlserver
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/emvi/hide"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	redis "github.com/go-redis/redis/v8"
 	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/cache"
+	"github.com/maxtroughear/gqlserver/gqlerrors"
+	"github.com/maxtroughear/gqlserver/graphql/budget"
 	"github.com/maxtroughear/gqlserver/graphql/gqllogrus"
 	"github.com/maxtroughear/gqlserver/graphql/nrextension"
+	"github.com/maxtroughear/gqlserver/graphql/otelextension"
+	"github.com/maxtroughear/gqlserver/graphql/promextension"
+	"github.com/maxtroughear/gqlserver/graphql/safelist"
+	"github.com/maxtroughear/gqlserver/health"
 	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/maxtroughear/gqlserver/ratelimit"
+	"github.com/maxtroughear/gqlserver/redact"
 	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/v2/formatter"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 var (
@@ -24,10 +47,27 @@ var (
 )
 
 type Server struct {
-	router  *gin.Engine
-	config  ServerConfig
-	handler *handler.Server
-	Logger  *logrus.Entry
+	router    *gin.Engine
+	config    ServerConfig
+	handler   *handler.Server
+	nrApp     *newrelic.Application
+	nrHook    *LogrusNewrelicHook
+	tracer    *sdktrace.TracerProvider
+	metrics   *prometheus.Registry
+	auth      auth.Authenticator
+	safelist  *safelist.Safelist
+	rateLimit []gin.HandlerFunc
+	lifecycle *lifecycle
+	health    *health.Registry
+	readiness *health.Registry
+	reloader  *reloader
+	Logger    *logrus.Entry
+}
+
+// hookFlusher is implemented by logrus hooks which buffer entries and must be
+// flushed before the process exits
+type hookFlusher interface {
+	Flush(ctx context.Context) error
 }
 
 func NewServer(es graphql.ExecutableSchema, cfg ServerConfig) Server {
@@ -35,37 +75,113 @@ func NewServer(es graphql.ExecutableSchema, cfg ServerConfig) Server {
 
 	hide.UseHash(hide.NewHashID(cfg.IDHashSalt, cfg.IDHashMinLength))
 
-	logger := defaultLogger(cfg)
+	logger, err := newLogger(cfg)
+	if err != nil {
+		panic(err)
+	}
 	var nrApp *newrelic.Application
+	var nrHook *LogrusNewrelicHook
+
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		panic(err)
+	}
+
+	// redact before any other hook sees the entry, including hooks already
+	// added to cfg.Logger
+	if redactLogs(cfg) {
+		addFirstHook(logger.Logger, NewLogrusRedactHook(redactor))
+	}
 
 	if cfg.NewRelic.Enabled {
 		nrApp = newNrApp(cfg)
 
-		logrus.AddHook(NewLogrusNewrelicHook(nrApp))
+		nrHook = NewLogrusNewrelicHook(nrApp, cfg.NewRelic.Logs)
+		logger.Logger.AddHook(nrHook)
+	}
+
+	if logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		logger.WithField("config", cfg.Effective()).Debug("effective config")
 	}
 
+	configReloader := newReloader(cfg)
+
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		panic(err)
+	}
 
 	// router middleware
 	router.Use(gin.Recovery())
 	router.Use(middleware.GinContextToContextMiddleware())
+	var metrics *prometheus.Registry
+	if cfg.Metrics.Enabled {
+		metrics = newMetricsRegistry()
+		router.Use(middleware.PrometheusMiddleware(metrics))
+	}
 	if cfg.Cors.Enabled {
-		router.Use(configureCorsMiddleware(cfg.Cors))
+		router.Use(configReloader.corsMiddleware)
 	}
 	if nrApp != nil {
 		router.Use(middleware.NewRelicMiddleware(nrApp))
 	}
+	var tracer *sdktrace.TracerProvider
+	if cfg.OpenTelemetry.Enabled {
+		var err error
+		tracer, err = newTracerProvider(cfg)
+		if err != nil {
+			panic(err)
+		}
+		router.Use(middleware.OtelMiddleware(tracer, newPropagator(), cfg.ServiceName))
+	}
+	router.Use(middleware.RequestIDMiddleware(cfg.RequestIDHeader))
 	router.Use(middleware.LogrusMiddleware(logger))
-	if cfg.Auth.FirebaseEnabled {
-		firebaseApp := auth.NewFirebaseAuth(cfg.Auth)
-		router.Use(firebaseApp.FirebaseAuthMiddleware())
+	if cfg.AccessLog.Enabled {
+		router.Use(middleware.AccessLogMiddleware(cfg.AccessLog))
+	}
+	authenticator := newAuthenticator(cfg.Auth, logger)
+	if authenticator != nil {
+		router.Use(authenticator.Middleware())
 	}
 
 	server := Server{
-		router:  router,
-		config:  cfg,
-		handler: handler.New(es),
-		Logger:  logger,
+		router:    router,
+		config:    cfg,
+		handler:   handler.New(es),
+		nrApp:     nrApp,
+		nrHook:    nrHook,
+		tracer:    tracer,
+		metrics:   metrics,
+		auth:      authenticator,
+		lifecycle: newLifecycle(),
+		health:    health.NewRegistry(cfg.Health),
+		readiness: health.NewRegistry(cfg.Health),
+		reloader:  configReloader,
+		Logger:    logger,
+	}
+
+	server.rateLimit = newRateLimiters(cfg)
+
+	// unexpected errors are masked outside of development
+	server.handler.SetErrorPresenter(gqlerrors.Presenter{
+		Mask:   cfg.Environment == Staging || cfg.Environment == Prod,
+		Logger: logger,
+	}.Present)
+	server.handler.SetRecoverFunc(gqlerrors.Recover)
+	server.RegisterExtension(gqlerrors.RequestIDExtension{})
+
+	// built-in readiness checks
+	server.RegisterReadinessCheck("shutdown", server.lifecycle.readinessCheck, health.WithCacheTTL(0))
+	if pinger, ok := cfg.ApqCache.(health.Pinger); ok {
+		server.RegisterReadinessCheck("apqCache", pinger.Ping)
+	}
+	if pinger, ok := cfg.QueryCache.(health.Pinger); ok {
+		server.RegisterReadinessCheck("queryCache", pinger.Ping)
+	}
+	// token verification keeps working from cached keys while the auth
+	// provider is unavailable, so an outage shouldn't take the server out of rotation
+	if checker, ok := authenticator.(interface{ HealthCheck(context.Context) error }); ok {
+		server.RegisterReadinessCheck("auth", checker.HealthCheck, health.NonCritical())
 	}
 
 	s := new(strings.Builder)
@@ -73,15 +189,54 @@ func NewServer(es graphql.ExecutableSchema, cfg ServerConfig) Server {
 	f.FormatSchema(es.Schema())
 	parsedSchema = s.String()
 
+	// the extension is added without limits too, so that COMPLEXITY_LIMIT
+	// can be set by a reload
+	server.RegisterExtension(newComplexityBudget(cfg, logger, configReloader))
+
+	// the safelist must resolve persisted queries before the APQ extension,
+	// which is added with the transports when routes are registered
+	if cfg.Safelist.Mode != "" && cfg.Safelist.Mode != safelist.ModeOff {
+		list, err := newSafelist(cfg, logger)
+		if err != nil {
+			panic(err)
+		}
+		server.safelist = list
+		server.RegisterExtension(list)
+	}
+
 	// add logging extensions
 	if cfg.NewRelic.Enabled {
 		server.RegisterExtension(nrextension.NrExtension{
 			Config: cfg.NewRelic.GraphqlExtension,
 		})
 	}
+	if tracer != nil {
+		server.RegisterExtension(otelextension.NewOtelExtension(tracer, cfg.OpenTelemetry.GraphqlExtension))
+	}
+	if metrics != nil {
+		server.RegisterExtension(promextension.NewPromExtension(metrics, cfg.Metrics.GraphqlExtension))
+		if tiered, ok := cfg.ApqCache.(*cache.Tiered); ok {
+			metrics.MustRegister(promextension.NewTieredCacheCollector("apq", tiered))
+		}
+		if nrHook != nil {
+			metrics.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "newrelic_logs_dropped_total",
+				Help: "Number of log entries dropped because the New Relic log buffer was full.",
+			}, func() float64 {
+				return float64(nrHook.Dropped())
+			}))
+		}
+	}
 	server.RegisterExtension(gqllogrus.LogrusExtension{
 		Logger: server.Logger,
 	})
+	if cfg.SlowOperationLog.Threshold > 0 {
+		server.RegisterExtension(gqllogrus.SlowOperationExtension{
+			Config:   cfg.SlowOperationLog,
+			Logger:   server.Logger,
+			Redactor: redactor,
+		})
+	}
 
 	return server
 }
@@ -94,33 +249,306 @@ func (s *Server) RegisterExtension(extension graphql.HandlerExtension) {
 	s.handler.Use(extension)
 }
 
-func (s *Server) Run() {
-	registerRoutes(s.handler, &s.router.RouterGroup, s.config)
+// RegisterHealthCheck adds a check evaluated by the /health route
+func (s *Server) RegisterHealthCheck(name string, check health.CheckFunc, opts ...health.Option) {
+	s.health.Register(name, check, opts...)
+}
 
-	s.Logger.Infof("Server listening on %v", s.config.Port)
+// RegisterReadinessCheck adds a check evaluated by the /ready route
+func (s *Server) RegisterReadinessCheck(name string, check health.CheckFunc, opts ...health.Option) {
+	s.readiness.Register(name, check, opts...)
+}
 
-	s.router.Run(":" + strconv.Itoa(s.config.Port))
+// MetricsRegisterer registers additional Prometheus collectors to be served
+// alongside the server's own metrics. It returns nil when metrics are disabled.
+func (s *Server) MetricsRegisterer() prometheus.Registerer {
+	if s.metrics == nil {
+		return nil
+	}
+	return s.metrics
 }
 
-func ParsedSchema() string {
-	return parsedSchema
+// Run starts the server and blocks until SIGINT or SIGTERM is received,
+// at which point the server is gracefully shut down
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return s.RunContext(ctx)
 }
 
-func defaultLogger(cfg ServerConfig) *logrus.Entry {
-	logrus.SetOutput(os.Stdout)
+// RunContext starts the server and blocks until ctx is cancelled or the server
+// fails. When ctx is cancelled the server is gracefully shut down, waiting up to
+// ShutdownTimeout for in-flight operations and subscriptions to finish.
+// When a port can't be bound or the server fails, everything started is
+// stopped before the error is returned.
+func (s *Server) RunContext(ctx context.Context) error {
+	s.lifecycle.routesOnce.Do(s.registerRoutes)
 
-	logrus.SetLevel(cfg.LogLevel)
-	logrus.SetFormatter(&logrus.JSONFormatter{})
+	tlsConfig, certificates, err := newTLSConfig(s.config.TLS)
+	if err != nil {
+		return err
+	}
+
+	srv := s.lifecycle.newHTTPServer(":"+strconv.Itoa(s.config.Port), newHTTPHandler(s.config, s.router))
+	configureHTTPServer(s.config.HTTP, srv)
+	srv.TLSConfig = tlsConfig
+
+	// bind the main port before starting anything else, so that nothing is
+	// left running when it is in use
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		s.abort()
+		return err
+	}
+
+	if err := s.startExtraServers(); err != nil {
+		listener.Close()
+		s.abort()
+		return err
+	}
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+
+	go s.watchConfig(watchCtx)
+	if certificates != nil {
+		go certificates.watch(watchCtx, s.config.TLS.ReloadInterval, s.Logger)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// the certificate is served by the TLS config
+			serveErr <- srv.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- srv.Serve(listener)
+	}()
+
+	s.Logger.WithFields(logrus.Fields{
+		"tls": srv.TLSConfig != nil,
+		"h2c": s.config.HTTP.H2C,
+	}).Infof("Server listening on %v", s.config.Port)
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.abort()
+			return err
+		}
+		// Shutdown was called directly, wait for it to finish draining
+		<-s.lifecycle.done
+		return s.lifecycle.shutdownErr
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownDelay+s.config.ShutdownTimeout)
+		defer cancel()
+
+		return s.Shutdown(shutdownCtx)
+	}
+}
+
+// Shutdown gracefully shuts down the server. Readiness checks start failing
+// immediately and, after ShutdownDelay, the server stops accepting new connections,
+// waits for in-flight operations and subscriptions to finish until ctx is done,
+// closes any remaining connections and then flushes New Relic and logrus hooks,
+// which are given up to flushTimeout even if ctx is already done.
+// Shutdown only runs once, subsequent calls return the result of the first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lifecycle.shutdownOnce.Do(func() {
+		defer close(s.lifecycle.done)
+
+		s.lifecycle.shuttingDown.Store(true)
+		s.Logger.Info("Server shutting down")
 
-	hostname, _ := os.Hostname()
+		// readiness is now failing, keep serving until traffic stops being routed here
+		if s.config.ShutdownDelay > 0 {
+			select {
+			case <-time.After(s.config.ShutdownDelay):
+			case <-ctx.Done():
+			}
+		}
 
-	logger := logrus.WithFields(logrus.Fields{
-		"service":  cfg.ServiceName,
-		"env":      cfg.Environment,
-		"hostname": hostname,
+		var err error
+		if srv := s.lifecycle.server(); srv != nil {
+			err = srv.Shutdown(ctx)
+		}
+
+		if waitErr := s.lifecycle.wait(ctx); waitErr != nil {
+			s.Logger.WithField("active", s.lifecycle.active.Load()).
+				Warn("drain timeout exceeded, closing remaining connections")
+			if err == nil {
+				err = waitErr
+			}
+		}
+		s.lifecycle.closeConnections()
+
+		s.release(ctx)
+
+		s.lifecycle.shutdownErr = err
+	})
+
+	<-s.lifecycle.done
+	return s.lifecycle.shutdownErr
+}
+
+// abort stops the server after it failed to start or serve, releasing
+// everything Shutdown would without waiting for operations to finish
+func (s *Server) abort() {
+	s.lifecycle.shutdownOnce.Do(func() {
+		defer close(s.lifecycle.done)
+
+		s.lifecycle.shuttingDown.Store(true)
+		s.lifecycle.closeConnections()
+
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+
+		s.release(ctx)
 	})
+}
+
+// release shuts down the additional servers, closes the auth provider, caches
+// and safelist, and flushes telemetry
+func (s *Server) release(ctx context.Context) {
+	s.lifecycle.shutdownExtraServers(ctx)
 
-	return logger
+	if closer, ok := s.auth.(io.Closer); ok {
+		closer.Close()
+	}
+	if closer, ok := s.config.ApqCache.(io.Closer); ok {
+		closer.Close()
+	}
+	if s.safelist != nil {
+		s.safelist.Close()
+	}
+
+	s.flush()
+}
+
+// startExtraServers starts the metrics and admin servers when they have their
+// own ports
+func (s *Server) startExtraServers() error {
+	if s.metrics != nil && s.config.Metrics.Port != 0 {
+		mux := http.NewServeMux()
+		mux.Handle(s.config.Metrics.Path, s.metricsHandler())
+		err := s.startExtraServer("metrics", &http.Server{
+			Addr:    ":" + strconv.Itoa(s.config.Metrics.Port),
+			Handler: mux,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.config.Admin.Port != 0 {
+		admin, err := s.newAdminServer()
+		if err != nil {
+			return err
+		}
+		if err := s.startExtraServer("admin", admin); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startExtraServer binds srv's address, then serves srv in the background
+// until the server is shut down
+func (s *Server) startExtraServer(name string, srv *http.Server) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("%s server: %w", name, err)
+	}
+
+	s.lifecycle.addServer(srv)
+
+	go func() {
+		s.Logger.Infof("%s server listening on %v", name, srv.Addr)
+
+		var err error
+		if srv.TLSConfig != nil {
+			// certificates are set in the TLS config
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.WithError(err).Errorf("%s server failed", name)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metrics, promhttp.HandlerOpts{
+		Registry: s.metrics,
+	})
+}
+
+// flush sends any buffered telemetry before the process exits, waiting up to
+// flushTimeout
+func (s *Server) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	flushed := map[hookFlusher]bool{}
+	for _, hooks := range s.Logger.Logger.Hooks {
+		for _, hook := range hooks {
+			flusher, ok := hook.(hookFlusher)
+			if !ok || flushed[flusher] {
+				continue
+			}
+			flushed[flusher] = true
+
+			if err := flusher.Flush(ctx); err != nil {
+				s.Logger.WithError(err).Error("failed to flush logrus hook")
+			}
+		}
+	}
+
+	if s.tracer != nil {
+		if err := s.tracer.Shutdown(ctx); err != nil {
+			s.Logger.WithError(err).Error("failed to flush OpenTelemetry spans")
+		}
+	}
+
+	if s.nrHook != nil {
+		s.nrHook.Close()
+	}
+
+	if s.nrApp != nil {
+		// the hooks and tracer may have used some of the timeout
+		deadline, _ := ctx.Deadline()
+		s.nrApp.Shutdown(time.Until(deadline))
+	}
+}
+
+func ParsedSchema() string {
+	return parsedSchema
+}
+
+// redactLogs reports whether log output is redacted, by default only in production
+func redactLogs(cfg ServerConfig) bool {
+	switch cfg.Redact.Mode {
+	case redact.ModeOn:
+		return true
+	case redact.ModeOff:
+		return false
+	default:
+		return cfg.Environment == Prod
+	}
+}
+
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
 }
 
 func newNrApp(cfg ServerConfig) *newrelic.Application {
@@ -140,11 +568,166 @@ func newNrApp(cfg ServerConfig) *newrelic.Application {
 	return nrApp
 }
 
+// newAuthenticator creates the configured auth provider, or nil if auth is disabled.
+// Firebase takes precedence when multiple providers are enabled.
+func newAuthenticator(cfg auth.AuthConfig, logger *logrus.Entry) auth.Authenticator {
+	if cfg.FirebaseEnabled {
+		firebaseAuth := auth.NewFirebaseAuth(cfg)
+		return &firebaseAuth
+	}
+
+	if cfg.JWKSEnabled {
+		jwksAuth, err := auth.NewJWKSAuth(cfg, logger)
+		if err != nil {
+			panic(err)
+		}
+		return jwksAuth
+	}
+
+	return nil
+}
+
+// newSafelist creates the safelist extension, loading the manifest from a file
+// or from Redis
+func newSafelist(cfg ServerConfig, logger *logrus.Entry) (*safelist.Safelist, error) {
+	switch cfg.Safelist.Mode {
+	case safelist.ModeLog, safelist.ModeEnforce:
+	default:
+		return nil, fmt.Errorf("unknown safelist mode %q", cfg.Safelist.Mode)
+	}
+
+	var source safelist.Source
+	switch {
+	case cfg.Safelist.ManifestPath != "":
+		source = safelist.FileSource(cfg.Safelist.ManifestPath)
+	case cfg.Safelist.ManifestRedisKey != "":
+		client, err := redisClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		source = safelist.RedisSource(client, cfg.Safelist.ManifestRedisKey)
+	default:
+		return nil, errors.New("safelist requires a manifest path or redis key")
+	}
+
+	return safelist.New(cfg.Safelist, source, logger)
+}
+
+// newComplexityBudget creates the complexity limit and budget extension. The
+// ComplexityLimit of the reloaded config is the limit when no other limit
+// applies, and operations are not limited while it is 0
+func newComplexityBudget(cfg ServerConfig, logger *logrus.Entry, configReloader *reloader) *budget.ComplexityBudget {
+	ext := &budget.ComplexityBudget{
+		Policy: budget.PolicyFunc(func(ctx context.Context, rc *graphql.OperationContext) budget.Allowance {
+			return budget.TierPolicy{
+				Config:       cfg.ComplexityBudget,
+				DefaultLimit: configReloader.current().ComplexityLimit,
+			}.Allowance(ctx, rc)
+		}),
+		Window: cfg.ComplexityBudget.BudgetWindow,
+		Logger: logger,
+	}
+
+	if ext.Window > 0 {
+		switch cfg.ComplexityBudget.BudgetBackend {
+		case budget.BackendMemory:
+			ext.Store = budget.NewMemoryStore()
+		case budget.BackendRedis:
+			client, err := redisClient(cfg)
+			if err != nil {
+				panic(err)
+			}
+			ext.Store = budget.NewRedisStore(client, cfg.ServiceName)
+		default:
+			panic(fmt.Errorf("unknown complexity budget backend %q", cfg.ComplexityBudget.BudgetBackend))
+		}
+	}
+
+	return ext
+}
+
+// newRateLimiters creates a rate limit middleware for each rule
+func newRateLimiters(cfg ServerConfig) []gin.HandlerFunc {
+	if !cfg.RateLimit.Enabled {
+		return nil
+	}
+
+	var client redis.UniversalClient
+	if cfg.RateLimit.Backend == ratelimit.BackendRedis {
+		var err error
+		client, err = redisClient(cfg)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	handlers := make([]gin.HandlerFunc, 0, len(cfg.RateLimit.Rules))
+	for _, rule := range cfg.RateLimit.Rules {
+		key, err := rateLimitKey(rule.Key, cfg.RateLimit)
+		if err != nil {
+			panic(err)
+		}
+
+		// limits for each rule are kept separately
+		prefix := cfg.ServiceName + ":" + rule.String()
+
+		var limiter ratelimit.Limiter
+		switch {
+		case cfg.RateLimit.Backend == ratelimit.BackendMemory && cfg.RateLimit.Algorithm == ratelimit.AlgorithmTokenBucket:
+			limiter = ratelimit.NewTokenBucket(rule.Limit, rule.Period)
+		case cfg.RateLimit.Backend == ratelimit.BackendMemory && cfg.RateLimit.Algorithm == ratelimit.AlgorithmSlidingWindow:
+			limiter = ratelimit.NewSlidingWindow(rule.Limit, rule.Period)
+		case cfg.RateLimit.Backend == ratelimit.BackendRedis && cfg.RateLimit.Algorithm == ratelimit.AlgorithmTokenBucket:
+			limiter = ratelimit.NewRedisTokenBucket(client, prefix, rule.Limit, rule.Period)
+		case cfg.RateLimit.Backend == ratelimit.BackendRedis && cfg.RateLimit.Algorithm == ratelimit.AlgorithmSlidingWindow:
+			limiter = ratelimit.NewRedisSlidingWindow(client, prefix, rule.Limit, rule.Period)
+		default:
+			panic(fmt.Errorf("unknown rate limit backend %q or algorithm %q", cfg.RateLimit.Backend, cfg.RateLimit.Algorithm))
+		}
+
+		handlers = append(handlers, middleware.RateLimit(limiter, key))
+	}
+
+	return handlers
+}
+
+// rateLimitKey returns the key function for a rule key, such as "ip" or "uid+operation"
+func rateLimitKey(name string, cfg RateLimitConfig) (middleware.KeyFunc, error) {
+	var keys []middleware.KeyFunc
+	for _, part := range strings.Split(name, "+") {
+		switch part {
+		case "ip":
+			keys = append(keys, middleware.ClientIPKey)
+		case "uid":
+			keys = append(keys, auth.UIDKey)
+		case "operation":
+			keys = append(keys, middleware.OperationNameKey(cfg.MaxBodyBytes))
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %q", part)
+		}
+	}
+
+	if len(keys) == 1 {
+		return keys[0], nil
+	}
+	return middleware.CombineKeys(keys...), nil
+}
+
+// redisClient returns the Redis client of the APQ cache, or connects to Redis
+// if the APQ cache doesn't use it
+func redisClient(cfg ServerConfig) (redis.UniversalClient, error) {
+	if c, ok := cfg.ApqCache.(interface{ Client() redis.UniversalClient }); ok {
+		return c.Client(), nil
+	}
+	return cache.NewRedisClient(cfg.Redis)
+}
+
 func configureCorsMiddleware(cfg CorsConfig) gin.HandlerFunc {
 	corsConfig := cors.DefaultConfig()
 
 	corsConfig.AllowOrigins = cfg.AllowOrigins
 	corsConfig.AddAllowHeaders("Authorization")
+	corsConfig.AddExposeHeaders(cfg.ExposeHeaders...)
 
 	return cors.New(corsConfig)
 }
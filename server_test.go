@@ -0,0 +1,67 @@
+package gqlserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunContextReleasesPortsWhenBindFails(t *testing.T) {
+	used, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer used.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg := DefaultConfig
+	cfg.Logger = logger
+	cfg.ReloadInterval = 0
+	cfg.Port = used.Addr().(*net.TCPAddr).Port
+	cfg.Admin.Port = freePort(t)
+	server := NewServer(websocketTestSchema{}, cfg)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.RunContext(context.Background())
+	}()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected an error when the port is in use")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext didn't return when the port is in use")
+	}
+
+	admin, err := net.Listen("tcp", net.JoinHostPort(cfg.Admin.Address, strconv.Itoa(cfg.Admin.Port)))
+	if err != nil {
+		t.Fatalf("expected the admin port to be released: %v", err)
+	}
+	admin.Close()
+
+	// the failed run counts as the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("expected shutdown after a failed run to return nil, got %v", err)
+	}
+}
+
+// freePort returns a port which nothing is listening on
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,13 @@
+package gqlserver
+
+import (
+	"log/slog"
+
+	"github.com/maxtroughear/gqlserver/graphql/gqllogrus"
+)
+
+// SlogHandler returns a slog.Handler writing to the logger of the request in
+// the context, or to the server's logger outside of requests
+func (s *Server) SlogHandler() slog.Handler {
+	return gqllogrus.NewSlogHandler(s.Logger)
+}
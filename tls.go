@@ -0,0 +1,173 @@
+package gqlserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Client certificate policies
+const (
+	TLSClientAuthRequire       = "require"
+	TLSClientAuthVerifyIfGiven = "verify-if-given"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newHTTPHandler wraps handler to accept HTTP/2 without TLS when h2c is enabled
+func newHTTPHandler(cfg ServerConfig, handler http.Handler) http.Handler {
+	if !cfg.HTTP.H2C {
+		return handler
+	}
+	return h2c.NewHandler(handler, &http2.Server{
+		IdleTimeout: cfg.HTTP.IdleTimeout,
+	})
+}
+
+// configureHTTPServer sets the timeouts and limits of srv
+func configureHTTPServer(cfg HTTPConfig, srv *http.Server) {
+	srv.ReadTimeout = cfg.ReadTimeout
+	srv.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	srv.WriteTimeout = cfg.WriteTimeout
+	srv.IdleTimeout = cfg.IdleTimeout
+	srv.MaxHeaderBytes = cfg.MaxHeaderBytes
+}
+
+// newTLSConfig creates the TLS config of the main server, or nil when no
+// certificate is set. The certificate is served by the returned reloader
+func newTLSConfig(cfg TLSConfig) (*tls.Config, *certificateReloader, error) {
+	if cfg.CertFile == "" {
+		return nil, nil, nil
+	}
+
+	certificates, err := newCertificateReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: certificates.getCertificate,
+		MinVersion:     tlsVersions[cfg.MinVersion],
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientAuth == TLSClientAuthVerifyIfGiven {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return tlsConfig, certificates, nil
+}
+
+// loadCertPool reads the PEM encoded certificates in a CA file
+func loadCertPool(path string) (*x509.CertPool, error) {
+	ca, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", path)
+	}
+	return pool, nil
+}
+
+// certificateReloader serves a certificate which is reloaded when its files
+// change, so that renewed certificates are used without a restart
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	certificate atomic.Pointer[tls.Certificate]
+	hash        [sha256.Size]byte
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	c := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if _, err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the certificate again, reporting whether its files changed.
+// The previous certificate is kept when the files can't be loaded
+func (c *certificateReloader) load() (bool, error) {
+	certPEM, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read TLS key: %w", err)
+	}
+
+	hash := sha256.Sum256(append(certPEM, keyPEM...))
+	if hash == c.hash {
+		return false, nil
+	}
+
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	c.hash = hash
+	c.certificate.Store(&certificate)
+	return true, nil
+}
+
+func (c *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate.Load(), nil
+}
+
+// watch reloads the certificate when its files change, until ctx is done
+func (c *certificateReloader) watch(ctx context.Context, interval time.Duration, logger *logrus.Entry) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := c.load()
+			if err != nil {
+				// keep serving the previous certificate, the files may be mid-write
+				logger.WithError(err).Warn("failed to reload TLS certificate")
+				continue
+			}
+			if changed {
+				logger.WithField("file", c.certFile).Info("reloaded TLS certificate")
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gqlserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gorilla/websocket"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/middleware"
+)
+
+// websocketCloseUnauthorized is the close code sent when a websocket is not,
+// or is no longer, authorised. This is the code used by graphql-ws clients.
+const websocketCloseUnauthorized = 4401
+
+type websocketCloseContextKey struct{}
+
+// websocketClose holds the code and reason of the close frame sent once a
+// connection is rejected. gqlgen always closes with a normal closure, so the
+// close frame it writes is replaced as it is written to the connection
+type websocketClose struct {
+	mu     sync.Mutex
+	code   int
+	reason string
+}
+
+// set replaces the close frame gqlgen sends next
+func (c *websocketClose) set(code int, reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.code = code
+	c.reason = reason
+}
+
+// frame returns the close frame to send instead of gqlgen's, or nil if the
+// connection hasn't been rejected
+func (c *websocketClose) frame() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.code == 0 {
+		return nil
+	}
+
+	// unmasked, final close frame
+	payload := websocket.FormatCloseMessage(c.code, c.reason)
+	return append([]byte{0x80 | websocket.CloseMessage, byte(len(payload))}, payload...)
+}
+
+func websocketCloseFromContext(ctx context.Context) *websocketClose {
+	closer, _ := ctx.Value(websocketCloseContextKey{}).(*websocketClose)
+	return closer
+}
+
+// websocketCloseWriter hijacks connections which replace gqlgen's close frame
+type websocketCloseWriter struct {
+	http.ResponseWriter
+	close *websocketClose
+}
+
+func (w websocketCloseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return websocketCloseConn{Conn: conn, close: w.close}, rw, nil
+}
+
+type websocketCloseConn struct {
+	net.Conn
+	close *websocketClose
+}
+
+// Write replaces the close frame once the connection has been rejected.
+// Control frames are always written by a single call
+func (c websocketCloseConn) Write(p []byte) (int, error) {
+	if len(p) > 0 && p[0] == 0x80|websocket.CloseMessage {
+		if frame := c.close.frame(); frame != nil {
+			if _, err := c.Conn.Write(frame); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	return c.Conn.Write(p)
+}
+
+// withWebsocketClose wraps the response writer so that the close code of the
+// websocket it upgrades to can be set from the request context
+func withWebsocketClose(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	closer := &websocketClose{}
+	ctx := context.WithValue(r.Context(), websocketCloseContextKey{}, closer)
+
+	return websocketCloseWriter{ResponseWriter: w, close: closer}, r.WithContext(ctx)
+}
+
+// websocketInitFunc authenticates websocket connections using a token from the
+// connection_init payload, as browsers cannot set headers on websocket upgrades.
+// Connections with an invalid token are closed with websocketCloseUnauthorized,
+// as are authenticated connections once their token expires, whether it was
+// sent in the payload or with the upgrade request in a header or cookie.
+func websocketInitFunc(authenticator auth.Authenticator) transport.WebsocketInitFunc {
+	return func(ctx context.Context, initPayload transport.InitPayload) (context.Context, error) {
+		log := middleware.LogrusFromContext(ctx)
+
+		// set by the auth middleware from the upgrade request
+		principal := auth.PrincipalFromContext(ctx)
+
+		if rawToken := websocketToken(initPayload); rawToken != "" {
+			authCtx, payloadPrincipal, err := authenticator.Authenticate(ctx, rawToken)
+			if err != nil {
+				log.WithError(err).Info("websocket connection rejected, invalid auth token")
+				websocketCloseFromContext(ctx).set(websocketCloseUnauthorized, "unauthorized")
+				return ctx, errors.New("unauthorized")
+			}
+
+			log.WithField("auth.uid", payloadPrincipal.Subject).Debug("websocket connection authenticated")
+			middleware.RequestInfoFromContext(ctx).SetUserID(payloadPrincipal.Subject)
+
+			ctx, principal = authCtx, payloadPrincipal
+		}
+
+		if principal == nil || principal.ExpiresAt.IsZero() {
+			return ctx, nil
+		}
+
+		// gqlgen closes the connection when its context is cancelled
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			expiry := time.NewTimer(time.Until(principal.ExpiresAt))
+			defer expiry.Stop()
+
+			select {
+			case <-ctx.Done():
+			case <-expiry.C:
+				log.WithField("auth.uid", principal.Subject).Info("websocket connection closed, auth token expired")
+				websocketCloseFromContext(ctx).set(websocketCloseUnauthorized, "token expired")
+				cancel()
+			}
+		}()
+
+		return ctx, nil
+	}
+}
+
+// websocketToken finds a token in the connection_init payload, accepting
+// either an Authorization value or a token field
+func websocketToken(initPayload transport.InitPayload) string {
+	if authorization := initPayload.Authorization(); authorization != "" {
+		if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+			return authorization[7:]
+		}
+		return authorization
+	}
+
+	if token := initPayload.GetString("token"); token != "" {
+		return token
+	}
+	return initPayload.GetString("authToken")
+}
@@ -0,0 +1,248 @@
+package gqlserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+	"github.com/maxtroughear/gqlserver/auth"
+	"github.com/maxtroughear/gqlserver/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestWebsocketClosesUnauthorizedConnections(t *testing.T) {
+	authenticator, sign := newWebsocketTestAuthenticator(t)
+
+	tests := []struct {
+		name     string
+		token    string
+		expiring bool
+		header   bool
+		reason   string
+	}{
+		{name: "invalid token", token: "invalid", reason: "unauthorized"},
+		{name: "expired token", expiring: true, reason: "token expired"},
+		{name: "expired header token", expiring: true, header: true, reason: "token expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebsocketTestServer(authenticator)
+			defer server.Close()
+
+			var conn *recordingConn
+			dialer := websocket.Dialer{
+				Subprotocols: []string{"graphql-ws"},
+				NetDial: func(network, addr string) (net.Conn, error) {
+					c, err := net.Dial(network, addr)
+					conn = &recordingConn{Conn: c}
+					return conn, err
+				},
+			}
+			token := tt.token
+			if tt.expiring {
+				token = sign(2 * time.Second)
+			}
+			header := http.Header{}
+			if tt.header {
+				header.Set("Authorization", "Bearer "+token)
+			}
+			ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+
+			payload := map[string]string{}
+			if !tt.header {
+				payload["authToken"] = token
+			}
+			err = ws.WriteJSON(map[string]interface{}{
+				"type":    "connection_init",
+				"payload": payload,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for err == nil {
+				_, _, err = ws.ReadMessage()
+			}
+
+			// read anything sent after the close frame until the server hangs up
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			io.Copy(io.Discard, conn)
+
+			if n := countCloseFrames(t, conn.recorded()); n != 1 {
+				t.Fatalf("expected exactly 1 close frame, got %d", n)
+			}
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != websocketCloseUnauthorized || closeErr.Text != tt.reason {
+				t.Fatalf("expected close %d %q, got %v", websocketCloseUnauthorized, tt.reason, err)
+			}
+		})
+	}
+}
+
+func newWebsocketTestServer(authenticator auth.Authenticator) *httptest.Server {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	entry := logrus.NewEntry(logger)
+	srv := handler.New(websocketTestSchema{})
+	enabled := func() bool { return false }
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.LogrusMiddleware(entry), authenticator.Middleware())
+	router.GET("/", graphqlHandler(srv, DefaultConfig, authenticator, entry, enabled))
+
+	return httptest.NewServer(router)
+}
+
+// newWebsocketTestAuthenticator creates a JWKS authenticator and a function
+// signing tokens which expire after a duration
+func newWebsocketTestAuthenticator(t *testing.T) (auth.Authenticator, func(time.Duration) string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keySet, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(keyFile, keySet, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	authenticator, err := auth.NewJWKSAuth(auth.AuthConfig{JWKSKeyFile: keyFile}, logrus.NewEntry(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { authenticator.Close() })
+
+	sign := func(expiry time.Duration) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub": "user",
+			"exp": time.Now().Add(expiry).Unix(),
+		})
+		token.Header["kid"] = "test"
+
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	return authenticator, sign
+}
+
+// countCloseFrames counts the close frames in the server's side of a
+// websocket connection, starting with the HTTP upgrade response
+func countCloseFrames(t *testing.T, data []byte) int {
+	i := bytes.Index(data, []byte("\r\n\r\n"))
+	if i < 0 {
+		t.Fatal("missing upgrade response")
+	}
+	data = data[i+4:]
+
+	count := 0
+	for len(data) >= 2 {
+		opcode := data[0] & 0x0f
+		length := int(data[1] & 0x7f)
+		data = data[2:]
+		switch length {
+		case 126:
+			length = int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+		case 127:
+			length = int(binary.BigEndian.Uint64(data))
+			data = data[8:]
+		}
+		if length > len(data) {
+			t.Fatal("truncated websocket frame")
+		}
+
+		if opcode == websocket.CloseMessage {
+			count++
+		}
+		data = data[length:]
+	}
+	return count
+}
+
+// recordingConn records every byte read from the connection
+type recordingConn struct {
+	net.Conn
+
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.data.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *recordingConn) recorded() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data.Bytes()
+}
+
+var websocketTestSchemaAST = gqlparser.MustLoadSchema(&ast.Source{Input: `type Query { hello: String }`})
+
+type websocketTestSchema struct{}
+
+func (websocketTestSchema) Schema() *ast.Schema {
+	return websocketTestSchemaAST
+}
+
+func (websocketTestSchema) Complexity(typeName, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
+	return 0, false
+}
+
+func (websocketTestSchema) Exec(ctx context.Context) graphql.ResponseHandler {
+	return func(ctx context.Context) *graphql.Response {
+		return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+	}
+}